@@ -2,12 +2,15 @@ package nifi
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 )
@@ -22,6 +25,17 @@ type Client struct {
 	// Currently only flows that involve cross-resource interactions are wrapped into lock/unlock sections.
 	// Most of operations can still be performed in parallel.
 	Lock sync.Mutex
+
+	// Desired run status of processors, ports, controller services and remote process groups managed by
+	// the plugin, keyed by component id. Newly connected components are only started if they are supposed
+	// to run, so that components intentionally kept STOPPED or DISABLED are not started as a side effect.
+	runStatus     map[string]string
+	runStatusLock sync.Mutex
+
+	// Connections managed by the plugin, keyed by connection id. Remote process group removal only removes
+	// connections attached to its ports that are managed, it refuses to touch the others.
+	managedConnections     map[string]bool
+	managedConnectionsLock sync.Mutex
 }
 
 func NewClient(config Config) *Client {
@@ -46,10 +60,44 @@ func NewClient(config Config) *Client {
 		Config:     config,
 		Client:     httpClient,
 		HttpScheme: scheme,
+		runStatus:  map[string]string{},
+
+		managedConnections: map[string]bool{},
 	}
 	return client
 }
 
+func (c *Client) SetDesiredRunStatus(componentId string, runStatus string) {
+	c.runStatusLock.Lock()
+	defer c.runStatusLock.Unlock()
+	if c.runStatus == nil {
+		c.runStatus = map[string]string{}
+	}
+	c.runStatus[componentId] = runStatus
+}
+
+func (c *Client) GetDesiredRunStatus(componentId string) (string, bool) {
+	c.runStatusLock.Lock()
+	defer c.runStatusLock.Unlock()
+	runStatus, ok := c.runStatus[componentId]
+	return runStatus, ok
+}
+
+func (c *Client) SetConnectionManaged(connectionId string) {
+	c.managedConnectionsLock.Lock()
+	defer c.managedConnectionsLock.Unlock()
+	if c.managedConnections == nil {
+		c.managedConnections = map[string]bool{}
+	}
+	c.managedConnections[connectionId] = true
+}
+
+func (c *Client) IsConnectionManaged(connectionId string) bool {
+	c.managedConnectionsLock.Lock()
+	defer c.managedConnectionsLock.Unlock()
+	return c.managedConnections[connectionId]
+}
+
 // Common section
 
 type Revision struct {
@@ -79,14 +127,20 @@ func (c *Client) JsonCall(method string, url string, bodyIn interface{}, bodyOut
 	}
 
 	response, err := c.Client.Do(request)
-	log.Printf("[DEBUG]: http call to %s resulted in error code: %d", url, response.StatusCode)
 	if err != nil {
 		return 0, err
 	}
+	defer response.Body.Close()
+	log.Printf("[DEBUG]: http call to %s resulted in error code: %d", url, response.StatusCode)
 	if response.StatusCode >= 300 {
-		return response.StatusCode, fmt.Errorf("The call has failed with the code of %d", response.StatusCode)
+		// NiFi explains rejected requests in plain text
+		message, _ := ioutil.ReadAll(response.Body)
+		if 0 == len(message) {
+			return response.StatusCode, fmt.Errorf("The call has failed with the code of %d", response.StatusCode)
+		}
+		return response.StatusCode, fmt.Errorf("The call has failed with the code of %d: %s",
+			response.StatusCode, strings.TrimSpace(string(message)))
 	}
-	defer response.Body.Close()
 
 	if bodyOut != nil {
 		err = json.NewDecoder(response.Body).Decode(bodyOut)
@@ -98,6 +152,159 @@ func (c *Client) JsonCall(method string, url string, bodyIn interface{}, bodyOut
 	return response.StatusCode, nil
 }
 
+// Asynchronous Request section
+
+const (
+	AsyncRequestTimeout         = 5 * time.Minute
+	AsyncRequestInitialInterval = 500 * time.Millisecond
+	AsyncRequestMaxInterval     = 10 * time.Second
+)
+
+type AsyncRequestStatus struct {
+	Finished         bool
+	PercentCompleted int
+	State            string
+	FailureReason    string
+}
+
+// Describes a long running NiFi operation (drop, listing, update requests, state transitions etc.).
+// Poll is invoked with exponential backoff until it reports the request as finished. Optional Cleanup is
+// invoked in any case once polling is over, NiFi expects most of the requests to be deleted by the client.
+type AsyncRequest struct {
+	Name    string
+	Poll    func() (AsyncRequestStatus, error)
+	Cleanup func() error
+	Timeout time.Duration
+}
+
+// Context deadline (usually derived from resource timeouts) is honoured along with the request's own timeout,
+// the default timeout only applies when neither of those is set.
+func (c *Client) WaitForAsyncRequest(ctx context.Context, request AsyncRequest) error {
+	timeout := request.Timeout
+	if _, ok := ctx.Deadline(); !ok && 0 == timeout {
+		timeout = AsyncRequestTimeout
+	}
+	if 0 != timeout {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	err := c.pollAsyncRequest(ctx, request)
+	if nil != request.Cleanup {
+		cleanupErr := request.Cleanup()
+		if nil == err && nil != cleanupErr {
+			err = fmt.Errorf("Failed to clean up %s: %s", request.Name, cleanupErr)
+		}
+	}
+	return err
+}
+
+func (c *Client) pollAsyncRequest(ctx context.Context, request AsyncRequest) error {
+	interval := AsyncRequestInitialInterval
+	var lastErr error
+	for iteration := 1; ; iteration++ {
+		status, err := request.Poll()
+		if nil != err {
+			// Transient failures are retried until the request times out
+			lastErr = err
+			log.Printf("[DEBUG] Failed to check %s status: %s", request.Name, err)
+		} else {
+			if "" != status.FailureReason {
+				return fmt.Errorf("%s has failed: %s", request.Name, status.FailureReason)
+			}
+			if status.Finished {
+				return nil
+			}
+
+			// Log progress
+			log.Printf("[INFO] Waiting for %s %d (%d%% complete) %s...",
+				request.Name, iteration, status.PercentCompleted, status.State)
+		}
+
+		select {
+		case <-ctx.Done():
+			if context.DeadlineExceeded == ctx.Err() {
+				if nil != lastErr {
+					return fmt.Errorf("Timed out waiting for %s: %s", request.Name, lastErr)
+				}
+				return fmt.Errorf("Timed out waiting for %s", request.Name)
+			}
+			return fmt.Errorf("Cancelled waiting for %s: %s", request.Name, ctx.Err())
+		case <-time.After(interval):
+		}
+
+		interval *= 2
+		if interval > AsyncRequestMaxInterval {
+			interval = AsyncRequestMaxInterval
+		}
+	}
+}
+
+// Snippet section
+
+type SnippetEntity struct {
+	Snippet struct {
+		Id            string `json:"id"`
+		ParentGroupId string `json:"parentGroupId"`
+	} `json:"snippet"`
+}
+
+// Moves a single component (processors, funnels, inputPorts, outputPorts, processGroups, labels) into another
+// process group. Connections having both ends in the moved component (loops, connections between ports of a
+// moved process group) are moved along with it, NiFi refuses to move components connected to anything else.
+// The component is expected to be stopped.
+func (c *Client) MoveComponent(componentType string, componentId string, revision Revision, parentGroupId string, newParentGroupId string) error {
+	snippet := map[string]interface{}{
+		"parentGroupId": parentGroupId,
+		componentType: map[string]Revision{
+			componentId: revision,
+		},
+	}
+
+	connections, err := c.GetProcessGroupConnections(parentGroupId)
+	if nil != err {
+		return err
+	}
+	moved := func(hand ConnectionHand) bool {
+		return componentId == hand.Id || ("processGroups" == componentType && componentId == hand.GroupId)
+	}
+	included := map[string]Revision{}
+	blocking := []string{}
+	for _, connection := range connections.Connections {
+		sourceMoved := moved(connection.Component.Source)
+		destinationMoved := moved(connection.Component.Destination)
+		if sourceMoved && destinationMoved {
+			included[connection.Component.Id] = connection.Revision
+		} else if sourceMoved || destinationMoved {
+			blocking = append(blocking, connection.Component.Id)
+		}
+	}
+	if len(blocking) > 0 {
+		return fmt.Errorf("Component %s is connected to components staying in Process Group %s, "+
+			"remove or re-create these Connections first: %s", componentId, parentGroupId, strings.Join(blocking, ", "))
+	}
+	if len(included) > 0 {
+		snippet["connections"] = included
+	}
+
+	url := fmt.Sprintf("%s://%s/%s/snippets",
+		c.HttpScheme, c.Config.Host, c.Config.ApiPath)
+	created := SnippetEntity{}
+	_, err = c.JsonCall("POST", url, map[string]interface{}{"snippet": snippet}, &created)
+	if nil != err {
+		return err
+	}
+
+	move := SnippetEntity{}
+	move.Snippet.Id = created.Snippet.Id
+	move.Snippet.ParentGroupId = newParentGroupId
+	url = fmt.Sprintf("%s://%s/%s/snippets/%s",
+		c.HttpScheme, c.Config.Host, c.Config.ApiPath, created.Snippet.Id)
+	_, err = c.JsonCall("PUT", url, move, nil)
+	return err
+}
+
 // Process Group section
 
 type ProcessGroupComponent struct {
@@ -105,11 +312,52 @@ type ProcessGroupComponent struct {
 	ParentGroupId string   `json:"parentGroupId"`
 	Name          string   `json:"name"`
 	Position      Position `json:"position"`
+	Comments      string   `json:"comments"`
+	// Settings not supported by older NiFi versions are omitted unless specified, empty values clear them
+	FlowFileConcurrency                  *string `json:"flowfileConcurrency,omitempty"`
+	FlowFileOutboundPolicy               *string `json:"flowfileOutboundPolicy,omitempty"`
+	DefaultFlowFileExpiration            *string `json:"defaultFlowFileExpiration,omitempty"`
+	DefaultBackPressureObjectThreshold   *int    `json:"defaultBackPressureObjectThreshold,omitempty"`
+	DefaultBackPressureDataSizeThreshold *string `json:"defaultBackPressureDataSizeThreshold,omitempty"`
+	LogFileSuffix                        *string `json:"logFileSuffix,omitempty"`
+}
+
+type ProcessGroupStatusSnapshot struct {
+	ActiveThreadCount int `json:"activeThreadCount"`
+	FlowFilesQueued   int `json:"flowFilesQueued"`
+}
+
+type ProcessGroupStatus struct {
+	AggregateSnapshot ProcessGroupStatusSnapshot `json:"aggregateSnapshot"`
 }
 
 type ProcessGroup struct {
 	Revision  Revision              `json:"revision"`
 	Component ProcessGroupComponent `json:"component"`
+
+	// Component counts and status are reported by NiFi and ignored upon update
+	RunningCount  int                 `json:"runningCount,omitempty"`
+	StoppedCount  int                 `json:"stoppedCount,omitempty"`
+	InvalidCount  int                 `json:"invalidCount,omitempty"`
+	DisabledCount int                 `json:"disabledCount,omitempty"`
+	Status        *ProcessGroupStatus `json:"status,omitempty"`
+}
+
+type ProcessGroups struct {
+	ProcessGroups []ProcessGroup `json:"processGroups"`
+}
+
+type ProcessGroupControllerServices struct {
+	ControllerServices []ControllerService `json:"controllerServices"`
+}
+
+type ProcessGroupProcessors struct {
+	Processors []Processor `json:"processors"`
+}
+
+type ProcessGroupPorts struct {
+	InputPorts  []Port `json:"inputPorts"`
+	OutputPorts []Port `json:"outputPorts"`
 }
 
 func (c *Client) CreateProcessGroup(processGroup *ProcessGroup) error {
@@ -147,6 +395,86 @@ func (c *Client) DeleteProcessGroup(processGroup *ProcessGroup) error {
 	return err
 }
 
+func (c *Client) GetProcessGroupChildGroups(processGroupId string) ([]ProcessGroup, error) {
+	url := fmt.Sprintf("%s://%s/%s/process-groups/%s/process-groups",
+		c.HttpScheme, c.Config.Host, c.Config.ApiPath, processGroupId)
+	processGroups := ProcessGroups{}
+	_, err := c.JsonCall("GET", url, nil, &processGroups)
+	if nil != err {
+		return nil, err
+	}
+	return processGroups.ProcessGroups, nil
+}
+
+// Processors of the process group itself, descendant groups are not included.
+func (c *Client) GetProcessGroupProcessors(processGroupId string) ([]Processor, error) {
+	url := fmt.Sprintf("%s://%s/%s/process-groups/%s/processors",
+		c.HttpScheme, c.Config.Host, c.Config.ApiPath, processGroupId)
+	processors := ProcessGroupProcessors{}
+	_, err := c.JsonCall("GET", url, nil, &processors)
+	if nil != err {
+		return nil, err
+	}
+	return processors.Processors, nil
+}
+
+// Input and output ports of the process group itself, descendant groups are not included.
+func (c *Client) GetProcessGroupPorts(processGroupId string) ([]Port, error) {
+	ports := ProcessGroupPorts{}
+	for _, endpoint := range []string{"input-ports", "output-ports"} {
+		url := fmt.Sprintf("%s://%s/%s/process-groups/%s/%s",
+			c.HttpScheme, c.Config.Host, c.Config.ApiPath, processGroupId, endpoint)
+		_, err := c.JsonCall("GET", url, nil, &ports)
+		if nil != err {
+			return nil, err
+		}
+	}
+	return append(ports.InputPorts, ports.OutputPorts...), nil
+}
+
+// Schedules (RUNNING, STOPPED) components of the process group and its descendants.
+// Only the listed components are affected, unless components are nil.
+func (c *Client) SetProcessGroupState(processGroupId string, state string, components map[string]Revision) error {
+	stateUpdate := map[string]interface{}{
+		"id":    processGroupId,
+		"state": state,
+	}
+	if nil != components {
+		stateUpdate["components"] = components
+	}
+	url := fmt.Sprintf("%s://%s/%s/flow/process-groups/%s",
+		c.HttpScheme, c.Config.Host, c.Config.ApiPath, processGroupId)
+	_, err := c.JsonCall("PUT", url, stateUpdate, nil)
+	return err
+}
+
+// Enables or disables controller services of the process group and its descendants, NiFi takes care of the
+// dependency order. Only the listed services are affected, unless components are nil.
+func (c *Client) SetProcessGroupControllerServicesState(processGroupId string, state string, components map[string]Revision) error {
+	stateUpdate := map[string]interface{}{
+		"id":    processGroupId,
+		"state": state,
+	}
+	if nil != components {
+		stateUpdate["components"] = components
+	}
+	url := fmt.Sprintf("%s://%s/%s/flow/process-groups/%s/controller-services",
+		c.HttpScheme, c.Config.Host, c.Config.ApiPath, processGroupId)
+	_, err := c.JsonCall("PUT", url, stateUpdate, nil)
+	return err
+}
+
+func (c *Client) GetProcessGroupControllerServices(processGroupId string) ([]ControllerService, error) {
+	url := fmt.Sprintf("%s://%s/%s/flow/process-groups/%s/controller-services?includeAncestorGroups=false&includeDescendantGroups=true",
+		c.HttpScheme, c.Config.Host, c.Config.ApiPath, processGroupId)
+	controllerServices := ProcessGroupControllerServices{}
+	_, err := c.JsonCall("GET", url, nil, &controllerServices)
+	if nil != err {
+		return nil, err
+	}
+	return controllerServices.ControllerServices, nil
+}
+
 func (c *Client) GetProcessGroupConnections(processGroupId string) (*Connections, error) {
 	url := fmt.Sprintf("%s://%s/%s/process-groups/%s/connections",
 		c.HttpScheme, c.Config.Host, c.Config.ApiPath, processGroupId)
@@ -158,6 +486,108 @@ func (c *Client) GetProcessGroupConnections(processGroupId string) (*Connections
 	return &connections, nil
 }
 
+type Variable struct {
+	Name           string  `json:"name"`
+	Value          *string `json:"value"`
+	ProcessGroupId string  `json:"processGroupId,omitempty"`
+}
+
+type VariableEntity struct {
+	Variable Variable `json:"variable"`
+}
+
+type VariableRegistry struct {
+	ProcessGroupId string           `json:"processGroupId"`
+	Variables      []VariableEntity `json:"variables"`
+}
+
+type VariableRegistryEntity struct {
+	ProcessGroupRevision Revision         `json:"processGroupRevision"`
+	VariableRegistry     VariableRegistry `json:"variableRegistry"`
+}
+
+type VariableRegistryUpdateRequest struct {
+	Request struct {
+		RequestId        string `json:"requestId"`
+		Complete         bool   `json:"complete"`
+		PercentCompleted int    `json:"percentCompleted"`
+		State            string `json:"state"`
+		FailureReason    string `json:"failureReason,omitempty"`
+	} `json:"request"`
+}
+
+// Returns variables declared by the process group itself, inherited variables are not included.
+func (c *Client) GetProcessGroupVariables(processGroupId string) (map[string]string, *Revision, error) {
+	url := fmt.Sprintf("%s://%s/%s/process-groups/%s/variable-registry?includeAncestorGroups=false",
+		c.HttpScheme, c.Config.Host, c.Config.ApiPath, processGroupId)
+	registry := VariableRegistryEntity{}
+	code, err := c.JsonCall("GET", url, nil, &registry)
+	if 404 == code {
+		return nil, nil, fmt.Errorf("not_found")
+	}
+	if nil != err {
+		return nil, nil, err
+	}
+
+	variables := map[string]string{}
+	for _, entity := range registry.VariableRegistry.Variables {
+		variable := entity.Variable
+		if ("" != variable.ProcessGroupId && processGroupId != variable.ProcessGroupId) || nil == variable.Value {
+			continue
+		}
+		variables[variable.Name] = *variable.Value
+	}
+	return variables, &registry.ProcessGroupRevision, nil
+}
+
+// Variables with nil values are removed. NiFi stops and restarts processors and controller services
+// referencing the variables as a part of the update request.
+func (c *Client) UpdateProcessGroupVariables(ctx context.Context, processGroupId string, revision Revision, variables map[string]*string) error {
+	registry := VariableRegistryEntity{
+		ProcessGroupRevision: revision,
+		VariableRegistry: VariableRegistry{
+			ProcessGroupId: processGroupId,
+			Variables:      []VariableEntity{},
+		},
+	}
+	for name, value := range variables {
+		registry.VariableRegistry.Variables = append(registry.VariableRegistry.Variables, VariableEntity{
+			Variable: Variable{
+				Name:  name,
+				Value: value,
+			},
+		})
+	}
+
+	url := fmt.Sprintf("%s://%s/%s/process-groups/%s/variable-registry/update-requests",
+		c.HttpScheme, c.Config.Host, c.Config.ApiPath, processGroupId)
+	updateRequest := VariableRegistryUpdateRequest{}
+	_, err := c.JsonCall("POST", url, registry, &updateRequest)
+	if nil != err {
+		return err
+	}
+
+	// Wait for the request to complete and remove it afterwards
+	url = fmt.Sprintf("%s://%s/%s/process-groups/%s/variable-registry/update-requests/%s",
+		c.HttpScheme, c.Config.Host, c.Config.ApiPath, processGroupId, updateRequest.Request.RequestId)
+	return c.WaitForAsyncRequest(ctx, AsyncRequest{
+		Name: fmt.Sprintf("Process Group %s variable registry update request", processGroupId),
+		Poll: func() (AsyncRequestStatus, error) {
+			_, err := c.JsonCall("GET", url, nil, &updateRequest)
+			return AsyncRequestStatus{
+				Finished:         updateRequest.Request.Complete,
+				PercentCompleted: updateRequest.Request.PercentCompleted,
+				State:            updateRequest.Request.State,
+				FailureReason:    updateRequest.Request.FailureReason,
+			}, err
+		},
+		Cleanup: func() error {
+			_, err := c.JsonCall("DELETE", url, nil, nil)
+			return err
+		},
+	})
+}
+
 // Processor section
 
 type ProcessorRelationship struct {
@@ -170,20 +600,35 @@ type ProcessorConfig struct {
 	SchedulingPeriod                 string `json:"schedulingPeriod"`
 	ExecutionNode                    string `json:"executionNode"`
 	ConcurrentlySchedulableTaskCount int    `json:"concurrentlySchedulableTaskCount"`
+	PenaltyDuration                  string `json:"penaltyDuration"`
+	YieldDuration                    string `json:"yieldDuration"`
+	BulletinLevel                    string `json:"bulletinLevel"`
+	RunDurationMillis                int    `json:"runDurationMillis"`
+	Comments                         string `json:"comments"`
+	AnnotationData                   string `json:"annotationData"`
+	LossTolerant                     bool   `json:"lossTolerant"`
+
+	// Retry settings are only supported by NiFi 1.16+, they are omitted unless specified
+	RetriedRelationships *[]string `json:"retriedRelationships,omitempty"`
+	RetryCount           *int      `json:"retryCount,omitempty"`
+	BackoffMechanism     string    `json:"backoffMechanism,omitempty"`
+	MaxBackoffPeriod     string    `json:"maxBackoffPeriod,omitempty"`
 
 	Properties                  map[string]interface{} `json:"properties"`
 	AutoTerminatedRelationships []string               `json:"autoTerminatedRelationships"`
 }
 
 type ProcessorComponent struct {
-	Id            string                  `json:"id,omitempty"`
-	ParentGroupId string                  `json:"parentGroupId,omitempty"`
-	Name          string                  `json:"name,omitempty"`
-	Type          string                  `json:"type,omitempty"`
-	Position      *Position               `json:"position,omitempty"`
-	State         string                  `json:"state,omitempty"`
-	Config        *ProcessorConfig        `json:"config,omitempty"`
-	Relationships []ProcessorRelationship `json:"relationships,omitempty"`
+	Id               string                  `json:"id,omitempty"`
+	ParentGroupId    string                  `json:"parentGroupId,omitempty"`
+	Name             string                  `json:"name,omitempty"`
+	Type             string                  `json:"type,omitempty"`
+	Position         *Position               `json:"position,omitempty"`
+	State            string                  `json:"state,omitempty"`
+	Config           *ProcessorConfig        `json:"config,omitempty"`
+	Relationships    []ProcessorRelationship `json:"relationships,omitempty"`
+	ValidationErrors []string                `json:"validationErrors,omitempty"`
+	ValidationStatus string                  `json:"validationStatus,omitempty"`
 }
 
 type Processor struct {
@@ -242,6 +687,15 @@ func (c *Client) GetProcessor(processorId string) (*Processor, error) {
 	}
 	processor.Component.Config.AutoTerminatedRelationships = relationships
 
+	// Validation status is not reported by NiFi prior to 1.6
+	if "" == processor.Component.ValidationStatus {
+		if len(processor.Component.ValidationErrors) > 0 {
+			processor.Component.ValidationStatus = "INVALID"
+		} else {
+			processor.Component.ValidationStatus = "VALID"
+		}
+	}
+
 	return processor, nil
 }
 
@@ -287,6 +741,67 @@ func (c *Client) StopProcessor(processor *Processor) error {
 	return c.SetProcessorState(processor, "STOPPED")
 }
 
+func (c *Client) DisableProcessor(processor *Processor) error {
+	return c.SetProcessorState(processor, "DISABLED")
+}
+
+func (c *Client) RunProcessorOnce(processor *Processor) error {
+	stateUpdate := map[string]interface{}{
+		"revision": Revision{
+			Version: processor.Revision.Version,
+		},
+		"state": "RUN_ONCE",
+	}
+	url := fmt.Sprintf("%s://%s/%s/processors/%s/run-status",
+		c.HttpScheme, c.Config.Host, c.Config.ApiPath, processor.Component.Id)
+	_, err := c.JsonCall("PUT", url, stateUpdate, processor)
+	return err
+}
+
+type StateEntry struct {
+	Key                string `json:"key"`
+	Value              string `json:"value"`
+	ClusterNodeId      string `json:"clusterNodeId,omitempty"`
+	ClusterNodeAddress string `json:"clusterNodeAddress,omitempty"`
+}
+
+type StateMap struct {
+	Scope           string       `json:"scope"`
+	TotalEntryCount int          `json:"totalEntryCount"`
+	State           []StateEntry `json:"state"`
+}
+
+type ComponentState struct {
+	ComponentState struct {
+		ComponentId      string    `json:"componentId"`
+		StateDescription string    `json:"stateDescription"`
+		ClusterState     *StateMap `json:"clusterState,omitempty"`
+		LocalState       *StateMap `json:"localState,omitempty"`
+	} `json:"componentState"`
+}
+
+func (c *Client) GetProcessorState(processorId string) (*ComponentState, error) {
+	url := fmt.Sprintf("%s://%s/%s/processors/%s/state",
+		c.HttpScheme, c.Config.Host, c.Config.ApiPath, processorId)
+	state := ComponentState{}
+	code, err := c.JsonCall("GET", url, nil, &state)
+	if 404 == code {
+		return nil, fmt.Errorf("not_found")
+	}
+	if nil != err {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (c *Client) ClearProcessorState(processor *Processor) error {
+	// Processor must not be running while its state is cleared
+	url := fmt.Sprintf("%s://%s/%s/processors/%s/state/clear-requests",
+		c.HttpScheme, c.Config.Host, c.Config.ApiPath, processor.Component.Id)
+	_, err := c.JsonCall("POST", url, nil, nil)
+	return err
+}
+
 // Connection section
 
 type ConnectionHand struct {
@@ -298,8 +813,16 @@ type ConnectionHand struct {
 type ConnectionComponent struct {
 	Id                            string         `json:"id,omitempty"`
 	ParentGroupId                 string         `json:"parentGroupId"`
+	Name                          string         `json:"name"`
 	BackPressureDataSizeThreshold string         `json:"backPressureDataSizeThreshold"`
 	BackPressureObjectThreshold   int            `json:"backPressureObjectThreshold"`
+	FlowFileExpiration            string         `json:"flowFileExpiration"`
+	Prioritizers                  []string       `json:"prioritizers"`
+	LoadBalanceStrategy           string         `json:"loadBalanceStrategy,omitempty"`
+	LoadBalancePartitionAttribute string         `json:"loadBalancePartitionAttribute,omitempty"`
+	LoadBalanceCompression        string         `json:"loadBalanceCompression,omitempty"`
+	LabelIndex                    int            `json:"labelIndex"`
+	ZIndex                        int            `json:"zIndex"`
 	Source                        ConnectionHand `json:"source"`
 	Destination                   ConnectionHand `json:"destination"`
 	SelectedRelationships         []string       `json:"selectedRelationships"`
@@ -315,10 +838,34 @@ type Connections struct {
 	Connections []Connection `json:"connections"`
 }
 
+type ConnectionStatusSnapshot struct {
+	FlowFilesIn     int    `json:"flowFilesIn"`
+	BytesIn         int64  `json:"bytesIn"`
+	Input           string `json:"input"`
+	FlowFilesOut    int    `json:"flowFilesOut"`
+	BytesOut        int64  `json:"bytesOut"`
+	Output          string `json:"output"`
+	FlowFilesQueued int    `json:"flowFilesQueued"`
+	BytesQueued     int64  `json:"bytesQueued"`
+	Queued          string `json:"queued"`
+	PercentUseCount int    `json:"percentUseCount"`
+	PercentUseBytes int    `json:"percentUseBytes"`
+}
+
+type ConnectionStatus struct {
+	ConnectionStatus struct {
+		Id                string                   `json:"id"`
+		AggregateSnapshot ConnectionStatusSnapshot `json:"aggregateSnapshot"`
+	} `json:"connectionStatus"`
+}
+
 type ConnectionDropRequest struct {
 	DropRequest struct {
-		Id       string `json:"id"`
-		Finished bool   `json:"finished"`
+		Id               string `json:"id"`
+		Finished         bool   `json:"finished"`
+		PercentCompleted int    `json:"percentCompleted"`
+		State            string `json:"state"`
+		FailureReason    string `json:"failureReason,omitempty"`
 	} `json:"dropRequest"`
 }
 
@@ -350,6 +897,15 @@ func (c *Client) UpdateConnection(connection *Connection) error {
 	return err
 }
 
+// Updates the connection, reports whether NiFi rejected the update as conflicting with the connection's state (409),
+// e.g. when its destination can't be changed while FlowFiles of its queue are held by the current destination.
+func (c *Client) TryUpdateConnection(connection *Connection) (bool, error) {
+	url := fmt.Sprintf("%s://%s/%s/connections/%s",
+		c.HttpScheme, c.Config.Host, c.Config.ApiPath, connection.Component.Id)
+	code, err := c.JsonCall("PUT", url, connection, connection)
+	return nil != err && 409 == code, err
+}
+
 func (c *Client) DeleteConnection(connection *Connection) error {
 	url := fmt.Sprintf("%s://%s/%s/connections/%s?version=%d",
 		c.HttpScheme, c.Config.Host, c.Config.ApiPath, connection.Component.Id, connection.Revision.Version)
@@ -357,7 +913,21 @@ func (c *Client) DeleteConnection(connection *Connection) error {
 	return err
 }
 
-func (c *Client) DropConnectionData(connection *Connection) error {
+func (c *Client) GetConnectionStatus(connectionId string) (*ConnectionStatus, error) {
+	url := fmt.Sprintf("%s://%s/%s/flow/connections/%s/status",
+		c.HttpScheme, c.Config.Host, c.Config.ApiPath, connectionId)
+	status := ConnectionStatus{}
+	code, err := c.JsonCall("GET", url, nil, &status)
+	if 404 == code {
+		return nil, fmt.Errorf("not_found")
+	}
+	if nil != err {
+		return nil, err
+	}
+	return &status, nil
+}
+
+func (c *Client) DropConnectionData(ctx context.Context, connection *Connection) error {
 	// Create a request to drop the contents of the queue in this connection
 	url := fmt.Sprintf("%s://%s/%s/flowfile-queues/%s/drop-requests",
 		c.HttpScheme, c.Config.Host, c.Config.ApiPath, connection.Component.Id)
@@ -367,51 +937,94 @@ func (c *Client) DropConnectionData(connection *Connection) error {
 		return err
 	}
 
-	// Give it some time to complete
-	maxAttempts := 10
-	for iteration := 0; iteration < maxAttempts; iteration++ {
-		// Check status of the request
-		url = fmt.Sprintf("%s://%s/%s/flowfile-queues/%s/drop-requests/%s",
-			c.HttpScheme, c.Config.Host, c.Config.ApiPath, connection.Component.Id, dropRequest.DropRequest.Id)
-		_, err = c.JsonCall("GET", url, nil, &dropRequest)
-		if nil != err {
-			continue
-		}
-		if dropRequest.DropRequest.Finished {
-			break
-		}
-
-		// Log progress
-		log.Printf("[INFO] Purging Connection data %s %d...", dropRequest.DropRequest.Id, iteration+1)
-
-		// Wait a bit
-		time.Sleep(3 * time.Second)
-
-		if maxAttempts-1 == iteration {
-			log.Printf("[INFO] Failed to purge the Connection %s", dropRequest.DropRequest.Id)
-		}
-	}
-
-	// Remove a request to drop the contents of this connection
+	// Wait for the request to complete and remove it afterwards
 	url = fmt.Sprintf("%s://%s/%s/flowfile-queues/%s/drop-requests/%s",
 		c.HttpScheme, c.Config.Host, c.Config.ApiPath, connection.Component.Id, dropRequest.DropRequest.Id)
-	_, err = c.JsonCall("DELETE", url, nil, nil)
+	return c.WaitForAsyncRequest(ctx, AsyncRequest{
+		Name: fmt.Sprintf("Connection %s drop request", connection.Component.Id),
+		Poll: func() (AsyncRequestStatus, error) {
+			_, err := c.JsonCall("GET", url, nil, &dropRequest)
+			return AsyncRequestStatus{
+				Finished:         dropRequest.DropRequest.Finished,
+				PercentCompleted: dropRequest.DropRequest.PercentCompleted,
+				State:            dropRequest.DropRequest.State,
+				FailureReason:    dropRequest.DropRequest.FailureReason,
+			}, err
+		},
+		Cleanup: func() error {
+			_, err := c.JsonCall("DELETE", url, nil, nil)
+			return err
+		},
+	})
+}
+
+type FlowFileSummary struct {
+	Uuid               string `json:"uuid"`
+	Filename           string `json:"filename"`
+	Position           int    `json:"position"`
+	Size               int64  `json:"size"`
+	QueuedDuration     int64  `json:"queuedDuration"`
+	LineageDuration    int64  `json:"lineageDuration"`
+	Penalized          bool   `json:"penalized"`
+	ClusterNodeId      string `json:"clusterNodeId,omitempty"`
+	ClusterNodeAddress string `json:"clusterNodeAddress,omitempty"`
+}
+
+type ConnectionListingRequest struct {
+	ListingRequest struct {
+		Id                string            `json:"id"`
+		Finished          bool              `json:"finished"`
+		PercentCompleted  int               `json:"percentCompleted"`
+		FailureReason     string            `json:"failureReason,omitempty"`
+		FlowFileSummaries []FlowFileSummary `json:"flowFileSummaries"`
+	} `json:"listingRequest"`
+}
+
+func (c *Client) ListConnectionData(ctx context.Context, connection *Connection) ([]FlowFileSummary, error) {
+	// Create a request to list the contents of the queue in this connection
+	url := fmt.Sprintf("%s://%s/%s/flowfile-queues/%s/listing-requests",
+		c.HttpScheme, c.Config.Host, c.Config.ApiPath, connection.Component.Id)
+	listingRequest := ConnectionListingRequest{}
+	_, err := c.JsonCall("POST", url, nil, &listingRequest)
 	if nil != err {
-		return err
+		return nil, err
 	}
 
-	return nil
+	// Wait for the request to complete and remove it afterwards
+	url = fmt.Sprintf("%s://%s/%s/flowfile-queues/%s/listing-requests/%s",
+		c.HttpScheme, c.Config.Host, c.Config.ApiPath, connection.Component.Id, listingRequest.ListingRequest.Id)
+	err = c.WaitForAsyncRequest(ctx, AsyncRequest{
+		Name: fmt.Sprintf("Connection %s listing request", connection.Component.Id),
+		Poll: func() (AsyncRequestStatus, error) {
+			_, err := c.JsonCall("GET", url, nil, &listingRequest)
+			return AsyncRequestStatus{
+				Finished:         listingRequest.ListingRequest.Finished,
+				PercentCompleted: listingRequest.ListingRequest.PercentCompleted,
+				FailureReason:    listingRequest.ListingRequest.FailureReason,
+			}, err
+		},
+		Cleanup: func() error {
+			_, err := c.JsonCall("DELETE", url, nil, nil)
+			return err
+		},
+	})
+	if nil != err {
+		return nil, err
+	}
+	return listingRequest.ListingRequest.FlowFileSummaries, nil
 }
 
 // Controller Service section
 
 type ControllerServiceComponent struct {
-	Id            string                 `json:"id,omitempty"`
-	ParentGroupId string                 `json:"parentGroupId,omitempty"`
-	Name          string                 `json:"name,omitempty"`
-	Type          string                 `json:"type,omitempty"`
-	State         string                 `json:"state,omitempty"`
-	Properties    map[string]interface{} `json:"properties"`
+	Id               string                 `json:"id,omitempty"`
+	ParentGroupId    string                 `json:"parentGroupId,omitempty"`
+	Name             string                 `json:"name,omitempty"`
+	Type             string                 `json:"type,omitempty"`
+	State            string                 `json:"state,omitempty"`
+	Properties       map[string]interface{} `json:"properties"`
+	ValidationErrors []string               `json:"validationErrors,omitempty"`
+	ValidationStatus string                 `json:"validationStatus,omitempty"`
 }
 
 type ControllerService struct {
@@ -422,6 +1035,12 @@ type ControllerService struct {
 func (c *Client) CreateControllerService(controllerService *ControllerService) error {
 	url := fmt.Sprintf("%s://%s/%s/process-groups/%s/controller-services",
 		c.HttpScheme, c.Config.Host, c.Config.ApiPath, controllerService.Component.ParentGroupId)
+	if "" == controllerService.Component.ParentGroupId {
+		// Controller level (management) services are not bound to any process group,
+		// those are available to reporting tasks and other controller level services
+		url = fmt.Sprintf("%s://%s/%s/controller/controller-services",
+			c.HttpScheme, c.Config.Host, c.Config.ApiPath)
+	}
 	_, err := c.JsonCall("POST", url, controllerService, controllerService)
 	if nil != err {
 		return err
@@ -442,6 +1061,16 @@ func (c *Client) GetControllerService(controllerServiceId string) (*ControllerSe
 		return nil, err
 	}
 	c.CleanupNilProperties(controllerService.Component.Properties)
+
+	// Validation status is not reported by NiFi prior to 1.6
+	if "" == controllerService.Component.ValidationStatus {
+		if len(controllerService.Component.ValidationErrors) > 0 {
+			controllerService.Component.ValidationStatus = "INVALID"
+		} else {
+			controllerService.Component.ValidationStatus = "VALID"
+		}
+	}
+
 	return &controllerService, nil
 }
 
@@ -464,19 +1093,20 @@ func (c *Client) DeleteControllerService(controllerService *ControllerService) e
 }
 
 func (c *Client) SetControllerServiceState(controllerService *ControllerService, state string) error {
-	stateUpdate := ControllerService{
-		Revision: Revision{
+	stateUpdate := map[string]interface{}{
+		"revision": Revision{
 			Version: controllerService.Revision.Version,
 		},
-		Component: ControllerServiceComponent{
-			Id:    controllerService.Component.Id,
-			State: state,
-		},
+		"state": state,
 	}
-	url := fmt.Sprintf("%s://%s/%s/controller-services/%s",
+	url := fmt.Sprintf("%s://%s/%s/controller-services/%s/run-status",
 		c.HttpScheme, c.Config.Host, c.Config.ApiPath, controllerService.Component.Id)
 	_, err := c.JsonCall("PUT", url, stateUpdate, controllerService)
-	return err
+	if nil != err {
+		return err
+	}
+	c.CleanupNilProperties(controllerService.Component.Properties)
+	return nil
 }
 
 func (c *Client) EnableControllerService(controllerService *ControllerService) error {
@@ -487,6 +1117,116 @@ func (c *Client) DisableControllerService(controllerService *ControllerService)
 	return c.SetControllerServiceState(controllerService, "DISABLED")
 }
 
+// Services referencing other services stay invalid until those are enabled, which may happen in parallel.
+const ControllerServiceValidationGracePeriod = 30 * time.Second
+
+// Invalid services are kept in the ENABLING state by NiFi forever, waiting for those to become ENABLED
+// fails with their validation errors once the services stay invalid for longer than the grace period.
+func (c *Client) WaitForControllerServiceState(ctx context.Context, controllerService *ControllerService, state string) error {
+	var invalidSince time.Time
+	return c.WaitForAsyncRequest(ctx, AsyncRequest{
+		Name: fmt.Sprintf("Controller Service %s to become %s", controllerService.Component.Id, state),
+		Poll: func() (AsyncRequestStatus, error) {
+			refreshed, err := c.GetControllerService(controllerService.Component.Id)
+			if nil != err {
+				return AsyncRequestStatus{}, err
+			}
+			*controllerService = *refreshed
+			status := AsyncRequestStatus{
+				Finished: state == refreshed.Component.State,
+				State:    refreshed.Component.State,
+			}
+			if !status.Finished && "ENABLED" == state && "INVALID" == refreshed.Component.ValidationStatus {
+				if invalidSince.IsZero() {
+					invalidSince = time.Now()
+				}
+				if time.Since(invalidSince) >= ControllerServiceValidationGracePeriod {
+					status.FailureReason = strings.Join(refreshed.Component.ValidationErrors, "; ")
+				}
+			} else {
+				invalidSince = time.Time{}
+			}
+			return status, nil
+		},
+	})
+}
+
+type ControllerServiceReferencingComponent struct {
+	Id                    string                                        `json:"id"`
+	ParentGroupId         string                                        `json:"groupId,omitempty"`
+	Name                  string                                        `json:"name"`
+	Type                  string                                        `json:"type"`
+	State                 string                                        `json:"state"`
+	ReferenceType         string                                        `json:"referenceType"`
+	ActiveThreadCount     int                                           `json:"activeThreadCount"`
+	ReferencingComponents []ControllerServiceReferencingComponentEntity `json:"referencingComponents"`
+}
+
+type ControllerServiceReferencingComponentEntity struct {
+	Id        string                                `json:"id"`
+	Revision  Revision                              `json:"revision"`
+	Component ControllerServiceReferencingComponent `json:"component"`
+}
+
+type ControllerServiceReferences struct {
+	ControllerServiceReferencingComponents []ControllerServiceReferencingComponentEntity `json:"controllerServiceReferencingComponents"`
+}
+
+type ControllerServiceReferencesUpdate struct {
+	Id                            string              `json:"id"`
+	State                         string              `json:"state"`
+	ReferencingComponentRevisions map[string]Revision `json:"referencingComponentRevisions"`
+}
+
+// Returns all the components referencing the controller service, including the ones referencing it indirectly
+// through other controller services.
+func (c *Client) GetControllerServiceReferences(controllerServiceId string) ([]ControllerServiceReferencingComponentEntity, error) {
+	url := fmt.Sprintf("%s://%s/%s/controller-services/%s/references",
+		c.HttpScheme, c.Config.Host, c.Config.ApiPath, controllerServiceId)
+	references := ControllerServiceReferences{}
+	code, err := c.JsonCall("GET", url, nil, &references)
+	if 404 == code {
+		return nil, fmt.Errorf("not_found")
+	}
+	if nil != err {
+		return nil, err
+	}
+
+	result := []ControllerServiceReferencingComponentEntity{}
+	visited := map[string]bool{}
+	var flatten func(entities []ControllerServiceReferencingComponentEntity)
+	flatten = func(entities []ControllerServiceReferencingComponentEntity) {
+		for _, entity := range entities {
+			if visited[entity.Id] {
+				continue
+			}
+			visited[entity.Id] = true
+			result = append(result, entity)
+			flatten(entity.Component.ReferencingComponents)
+		}
+	}
+	flatten(references.ControllerServiceReferencingComponents)
+	return result, nil
+}
+
+// Schedules (RUNNING, STOPPED) or enables (ENABLED, DISABLED) all the referencing components of the applicable kind.
+// NiFi requires revisions of every referencing component, references are expected to be fetched just before.
+func (c *Client) UpdateControllerServiceReferences(controllerServiceId string, state string, references []ControllerServiceReferencingComponentEntity) error {
+	revisions := map[string]Revision{}
+	for _, reference := range references {
+		revisions[reference.Id] = reference.Revision
+	}
+	update := ControllerServiceReferencesUpdate{
+		Id:                            controllerServiceId,
+		State:                         state,
+		ReferencingComponentRevisions: revisions,
+	}
+	url := fmt.Sprintf("%s://%s/%s/controller-services/%s/references",
+		c.HttpScheme, c.Config.Host, c.Config.ApiPath, controllerServiceId)
+	_, err := c.JsonCall("PUT", url, update, nil)
+	return err
+}
+
 //User Tennants
 type Tenant struct {
 	Id string `json:"id"`
@@ -667,13 +1407,48 @@ func (c *Client) DeleteGroup(group *Group) error {
 }
 
 //remote process group
+type RemoteProcessGroupBatchSettings struct {
+	Count    int    `json:"count,omitempty"`
+	Size     string `json:"size,omitempty"`
+	Duration string `json:"duration,omitempty"`
+}
+
+type RemoteProcessGroupPort struct {
+	Id                               string                           `json:"id"`
+	TargetId                         string                           `json:"targetId,omitempty"`
+	GroupId                          string                           `json:"groupId"`
+	Name                             string                           `json:"name,omitempty"`
+	Transmitting                     bool                             `json:"transmitting"`
+	Exists                           *bool                            `json:"exists,omitempty"`
+	Connected                        *bool                            `json:"connected,omitempty"`
+	ConcurrentlySchedulableTaskCount int                              `json:"concurrentlySchedulableTaskCount,omitempty"`
+	UseCompression                   *bool                            `json:"useCompression,omitempty"`
+	BatchSettings                    *RemoteProcessGroupBatchSettings `json:"batchSettings,omitempty"`
+}
+
+type RemoteProcessGroupContents struct {
+	InputPorts  []RemoteProcessGroupPort `json:"inputPorts"`
+	OutputPorts []RemoteProcessGroupPort `json:"outputPorts"`
+}
+
 type RemoteProcessGroupComponent struct {
-	Id                string   `json:"id,omitempty"`
-	ParentGroupId     string   `json:"parentGroupId"`
-	Name              string   `json:"name"`
-	Position          Position `json:"position"`
-	TargetUris        string   `json:"targetUris"`
-	TransportProtocol string   `json:"transportProtocol"`
+	Id                    string                      `json:"id,omitempty"`
+	ParentGroupId         string                      `json:"parentGroupId"`
+	Name                  string                      `json:"name"`
+	Position              Position                    `json:"position"`
+	TargetUris            string                      `json:"targetUris"`
+	TransportProtocol     string                      `json:"transportProtocol"`
+	CommunicationsTimeout string                      `json:"communicationsTimeout,omitempty"`
+	YieldDuration         string                      `json:"yieldDuration,omitempty"`
+	ProxyHost             string                      `json:"proxyHost"`
+	ProxyPort             int                         `json:"proxyPort,omitempty"`
+	ProxyUser             string                      `json:"proxyUser"`
+	ProxyPassword         string                      `json:"proxyPassword"`
+	LocalNetworkInterface string                      `json:"localNetworkInterface"`
+	Transmitting          *bool                       `json:"transmitting,omitempty"`
+	FlowRefreshed         string                      `json:"flowRefreshed,omitempty"`
+	AuthorizationIssues   []string                    `json:"authorizationIssues,omitempty"`
+	Contents              *RemoteProcessGroupContents `json:"contents,omitempty"`
 }
 
 type RemoteProcessGroup struct {
@@ -681,6 +1456,11 @@ type RemoteProcessGroup struct {
 	Component RemoteProcessGroupComponent `json:"component"`
 }
 
+type RemoteProcessGroupPortUpdate struct {
+	Revision               Revision               `json:"revision"`
+	RemoteProcessGroupPort RemoteProcessGroupPort `json:"remoteProcessGroupPort"`
+}
+
 func (c *Client) CreateRemoteProcessGroup(processGroup *RemoteProcessGroup) error {
 	url := fmt.Sprintf("%s://%s/%s/process-groups/%s/remote-process-groups",
 		c.HttpScheme, c.Config.Host, c.Config.ApiPath, processGroup.Component.ParentGroupId)
@@ -705,12 +1485,155 @@ func (c *Client) GetRemoteProcessGroup(processGroupId string) (*RemoteProcessGro
 func (c *Client) UpdateRemoteProcessGroup(processGroup *RemoteProcessGroup) error {
 	url := fmt.Sprintf("%s://%s/%s/remote-process-groups/%s",
 		c.HttpScheme, c.Config.Host, c.Config.ApiPath, processGroup.Component.Id)
+	// Contents are managed through remote process group port endpoints, transmission through run status
+	processGroup.Component.Contents = nil
+	processGroup.Component.Transmitting = nil
+	processGroup.Component.FlowRefreshed = ""
+	processGroup.Component.AuthorizationIssues = nil
 	_, err := c.JsonCall("PUT", url, processGroup, processGroup)
 	return err
 }
 
+// Remote ports are not known until NiFi contacts the target instance and refreshes the remote flow.
+// Waits until the flow is refreshed and every expected port reference (by port type) is discovered.
+func (c *Client) WaitForRemoteProcessGroupContents(ctx context.Context, processGroupId string, expectedPorts map[string][]string) (*RemoteProcessGroup, error) {
+	var processGroup *RemoteProcessGroup
+	err := c.WaitForAsyncRequest(ctx, AsyncRequest{
+		Name: fmt.Sprintf("Remote Process Group %s flow refresh", processGroupId),
+		Poll: func() (AsyncRequestStatus, error) {
+			refreshed, err := c.GetRemoteProcessGroup(processGroupId)
+			if nil != err {
+				return AsyncRequestStatus{}, err
+			}
+			processGroup = refreshed
+			if "" == refreshed.Component.FlowRefreshed || nil == refreshed.Component.Contents {
+				return AsyncRequestStatus{
+					State: strings.Join(refreshed.Component.AuthorizationIssues, "; "),
+				}, nil
+			}
+			missing := []string{}
+			for portType, portRefs := range expectedPorts {
+				for _, portRef := range portRefs {
+					if _, err := FindRemoteProcessGroupPort(refreshed, portType, portRef); nil != err {
+						missing = append(missing, portRef)
+					}
+				}
+			}
+			return AsyncRequestStatus{
+				Finished: 0 == len(missing),
+				State: fmt.Sprintf("ports %v not discovered yet %s",
+					missing, strings.Join(refreshed.Component.AuthorizationIssues, "; ")),
+			}, nil
+		},
+	})
+	return processGroup, err
+}
+
+func (c *Client) SetRemoteProcessGroupTransmission(processGroup *RemoteProcessGroup, transmitting bool) error {
+	state := "STOPPED"
+	if transmitting {
+		state = "TRANSMITTING"
+	}
+	stateUpdate := map[string]interface{}{
+		"revision": Revision{
+			Version: processGroup.Revision.Version,
+		},
+		"state": state,
+	}
+	url := fmt.Sprintf("%s://%s/%s/remote-process-groups/%s/run-status",
+		c.HttpScheme, c.Config.Host, c.Config.ApiPath, processGroup.Component.Id)
+	_, err := c.JsonCall("PUT", url, stateUpdate, processGroup)
+	return err
+}
+
+// Updates remote port settings (concurrent tasks, compression and batch settings), transmission is left as is.
+func (c *Client) UpdateRemoteProcessGroupPort(processGroup *RemoteProcessGroup, portType string, port *RemoteProcessGroupPort) error {
+	portUpdate := RemoteProcessGroupPortUpdate{
+		Revision: Revision{
+			Version: processGroup.Revision.Version,
+		},
+		RemoteProcessGroupPort: *port,
+	}
+	portUpdate.RemoteProcessGroupPort.GroupId = processGroup.Component.Id
+	endpoint := "input-ports"
+	if "REMOTE_OUTPUT_PORT" == portType {
+		endpoint = "output-ports"
+	}
+	url := fmt.Sprintf("%s://%s/%s/remote-process-groups/%s/%s/%s",
+		c.HttpScheme, c.Config.Host, c.Config.ApiPath, processGroup.Component.Id, endpoint, port.Id)
+	_, err := c.JsonCall("PUT", url, portUpdate, nil)
+	return err
+}
+
+// Remote ports can be referenced by their id within the remote process group, by their id on the target
+// instance or by their name.
+func (c *Client) GetRemoteProcessGroupPort(processGroupId string, portType string, portRef string) (*RemoteProcessGroup, *RemoteProcessGroupPort, error) {
+	processGroup, err := c.GetRemoteProcessGroup(processGroupId)
+	if nil != err {
+		return nil, nil, err
+	}
+	port, err := FindRemoteProcessGroupPort(processGroup, portType, portRef)
+	if nil != err {
+		return nil, nil, err
+	}
+	return processGroup, port, nil
+}
+
+func FindRemoteProcessGroupPort(processGroup *RemoteProcessGroup, portType string, portRef string) (*RemoteProcessGroupPort, error) {
+	ports := []RemoteProcessGroupPort{}
+	if nil != processGroup.Component.Contents {
+		switch portType {
+		case "REMOTE_INPUT_PORT":
+			ports = processGroup.Component.Contents.InputPorts
+		case "REMOTE_OUTPUT_PORT":
+			ports = processGroup.Component.Contents.OutputPorts
+		default:
+			return nil, fmt.Errorf("Invalid remote port type: %s", portType)
+		}
+	}
+	names := []string{}
+	for i, port := range ports {
+		if port.Id == portRef || port.TargetId == portRef || port.Name == portRef {
+			return &ports[i], nil
+		}
+		names = append(names, port.Name)
+	}
+	return nil, fmt.Errorf("Remote Process Group %s has no %s %s, available ports: %v",
+		processGroup.Component.Id, portType, portRef, names)
+}
+
+func (c *Client) SetRemoteProcessGroupPortTransmission(processGroupId string, portType string, portRef string, transmitting bool) error {
+	processGroup, port, err := c.GetRemoteProcessGroupPort(processGroupId, portType, portRef)
+	if nil != err {
+		return err
+	}
+	if port.Transmitting == transmitting {
+		return nil
+	}
+	log.Printf("[INFO] Setting Remote Process Group port %s transmission to %t", port.Id, transmitting)
+
+	portUpdate := RemoteProcessGroupPortUpdate{
+		Revision: Revision{
+			Version: processGroup.Revision.Version,
+		},
+		RemoteProcessGroupPort: RemoteProcessGroupPort{
+			Id:           port.Id,
+			GroupId:      processGroupId,
+			Transmitting: transmitting,
+		},
+	}
+	endpoint := "input-ports"
+	if "REMOTE_OUTPUT_PORT" == portType {
+		endpoint = "output-ports"
+	}
+	url := fmt.Sprintf("%s://%s/%s/remote-process-groups/%s/%s/%s",
+		c.HttpScheme, c.Config.Host, c.Config.ApiPath, processGroupId, endpoint, port.Id)
+	_, err = c.JsonCall("PUT", url, portUpdate, nil)
+	return err
+}
+
 func (c *Client) DeleteRemoteProcessGroup(processGroup *RemoteProcessGroup) error {
-	url := fmt.Sprintf("%s://%s/%s/process-groups/%s?version=%d",
+	url := fmt.Sprintf("%s://%s/%s/remote-process-groups/%s?version=%d",
 		c.HttpScheme, c.Config.Host, c.Config.ApiPath, processGroup.Component.Id, processGroup.Revision.Version)
 	_, err := c.JsonCall("DELETE", url, nil, nil)
 	return err
@@ -722,13 +1645,18 @@ type Port struct {
 	Component PortComponent `json:"component"`
 }
 type PortComponent struct {
-	Id            string   `json:"id,omitempty"`
-	ParentGroupId string   `json:"parentGroupId"`
-	Name          string   `json:"name"`
-	PortType      string   `json:"type"`
-	Comments      string   `json:"comments"`
-	Position      Position `json:"position"`
-	State         string   `json:"state,omitempty"`
+	Id                               string   `json:"id,omitempty"`
+	ParentGroupId                    string   `json:"parentGroupId"`
+	Name                             string   `json:"name"`
+	PortType                         string   `json:"type"`
+	Comments                         string   `json:"comments"`
+	Position                         Position `json:"position"`
+	State                            string   `json:"state,omitempty"`
+	AllowRemoteAccess                *bool    `json:"allowRemoteAccess,omitempty"`
+	ConcurrentlySchedulableTaskCount int      `json:"concurrentlySchedulableTaskCount,omitempty"`
+	UserAccessControl                []string `json:"userAccessControl"`
+	GroupAccessControl               []string `json:"groupAccessControl"`
+	PortFunction                     string   `json:"portFunction,omitempty"`
 }
 
 type PortStateComponent struct {
@@ -777,6 +1705,8 @@ func (c *Client) UpdatePort(port *Port) error {
 	}
 	return err
 }
+
+// Port type is optional, both input and output ports are looked up when it is not known.
 func (c *Client) GetPort(portId string, port_type string) (*Port, error) {
 	url := ""
 	switch port_type {
@@ -786,8 +1716,14 @@ func (c *Client) GetPort(portId string, port_type string) (*Port, error) {
 	case "OUTPUT_PORT":
 		url = fmt.Sprintf("%s://%s/%s/output-ports/%s",
 			c.HttpScheme, c.Config.Host, c.Config.ApiPath, portId)
+	case "":
+		port, err := c.GetPort(portId, "INPUT_PORT")
+		if nil != err && "not_found" == err.Error() {
+			return c.GetPort(portId, "OUTPUT_PORT")
+		}
+		return port, err
 	default:
-		log.Fatal(fmt.Printf("Invalid port type : %s.", port_type))
+		return nil, fmt.Errorf("Invalid port type: %s", port_type)
 	}
 	port := Port{}
 	code, err := c.JsonCall("GET", url, nil, &port)
@@ -818,7 +1754,9 @@ func (c *Client) DeletePort(port *Port) error {
 	return err
 }
 
-func (c *Client) SetPortState(port *Port, state string) error {
+// NiFi answers 409 both when the port is already in the requested state and when it refuses the transition
+// (e.g. an unconnected port cannot be started), only the former is considered a success.
+func (c *Client) SetPortState(ctx context.Context, port *Port, state string) error {
 	log.Printf("[Info] Set port to state %s", state)
 	//https://community.hortonworks.com/questions/67900/startstop-processor-via-nifi-api.html
 	stateUpdate := PortStateUpdate{
@@ -847,119 +1785,113 @@ func (c *Client) SetPortState(port *Port, state string) error {
 
 	responseCode, err := c.JsonCall("PUT", url, stateUpdate, port)
 	if err != nil {
-		log.Printf("[Fatal]: Failed to set state of  Port, error code %s.", err)
 		if responseCode == 409 {
-			// if 409, same state
-			log.Printf(fmt.Sprintf("[WARN]: 409 %s.", err))
-			err = nil
+			current, getErr := c.GetPort(portId, port_type)
+			if nil == getErr && state == current.Component.State {
+				*port = *current
+				return nil
+			}
 		}
+		log.Printf("[ERROR]: Failed to set state of Port %s: %s", portId, err)
+		return err
 	}
 
 	//verify port state
-	maxAttempts := 5
-	state_verified := false
-	for iteration := 0; iteration < maxAttempts; iteration++ {
-		// Check status of the request
-		// Wait a bit
-		time.Sleep(3 * time.Second)
-		_, err = c.JsonCall("GET", url, nil, port)
-		if nil != err {
-			continue
-		} else {
-			if port.Component.State == state {
-				log.Printf("[DEBUG] port status set")
-				state_verified = true
-				break
-			}
-		}
-		// Log progress
-		log.Printf("[DEBUG] Checking Port status %d %d...", portId, iteration+1)
-
-		if maxAttempts-1 == iteration {
-			log.Printf("[DEBUG] Failed to verify Port new status %s", state)
-		}
-	}
-	if !state_verified {
-		log.Printf("[DEBUG] Failed to verify Port new status %s", state)
-	}
-	return err
+	return c.WaitForAsyncRequest(ctx, AsyncRequest{
+		Name: fmt.Sprintf("Port %s to become %s", portId, state),
+		Poll: func() (AsyncRequestStatus, error) {
+			_, err := c.JsonCall("GET", url, nil, port)
+			return AsyncRequestStatus{
+				Finished: port.Component.State == state,
+				State:    port.Component.State,
+			}, err
+		},
+		Timeout: 30 * time.Second,
+	})
 }
 
-func (c *Client) StartPort(port *Port) error {
-	return c.SetPortState(port, "RUNNING")
+func (c *Client) StartPort(ctx context.Context, port *Port) error {
+	return c.SetPortState(ctx, port, "RUNNING")
 }
 
-func (c *Client) StopPort(port *Port) error {
-	return c.SetPortState(port, "STOPPED")
+func (c *Client) StopPort(ctx context.Context, port *Port) error {
+	return c.SetPortState(ctx, port, "STOPPED")
 }
 
-func (c *Client) DisablePort(port *Port) error {
-	return c.SetPortState(port, "DISABLED")
+func (c *Client) DisablePort(ctx context.Context, port *Port) error {
+	return c.SetPortState(ctx, port, "DISABLED")
 }
 
-func (c *Client) StopConnectionHand(connectionHand *ConnectionHand) error {
+// Stops the component on either end of a connection. Returns whether the component was running (transmitting,
+// for remote ports), callers are expected to start only those hands again once they are done.
+func (c *Client) StopConnectionHand(ctx context.Context, connectionHand *ConnectionHand) (bool, error) {
 	handType := connectionHand.Type
 	handId := connectionHand.Id
-	log.Printf("[DEBUG] Stop connection hand %s , %d", handType, handId)
+	log.Printf("[DEBUG] Stop connection hand %s , %s", handType, handId)
 	switch handType {
 	case "PROCESSOR":
 		processor, err := c.GetProcessor(handId)
 		if err != nil {
-			return c.StopProcessor(processor)
-		} else {
-			return err
+			return false, err
 		}
-	case "INPUT_PORT":
-		port, err := c.GetPort(handId, "INPUT_PORT")
-		if err == nil {
-			return c.StopPort(port)
-		} else {
-			log.Printf("Fail to get Port %s", handId)
-			return err
+		if "RUNNING" != processor.Component.State {
+			// Stopping a disabled processor would enable it
+			return false, nil
 		}
-	case "OUTPUT_PORT":
-		port, err := c.GetPort(handId, "OUTPUT_PORT")
-		if err == nil {
-			return c.StopPort(port)
-		} else {
+		return true, c.StopProcessor(processor)
+	case "INPUT_PORT", "OUTPUT_PORT":
+		port, err := c.GetPort(handId, handType)
+		if err != nil {
 			log.Printf("Fail to get Port %s", handId)
-			return err
+			return false, err
+		}
+		if "RUNNING" != port.Component.State {
+			return false, nil
 		}
+		return true, c.StopPort(ctx, port)
+	case "REMOTE_INPUT_PORT", "REMOTE_OUTPUT_PORT":
+		_, port, err := c.GetRemoteProcessGroupPort(connectionHand.GroupId, handType, handId)
+		if err != nil {
+			return false, err
+		}
+		if !port.Transmitting {
+			return false, nil
+		}
+		return true, c.SetRemoteProcessGroupPortTransmission(connectionHand.GroupId, handType, handId, false)
 	case "FUNNEL":
 		log.Printf("No need to stop Funnel")
-		return nil
+		return false, nil
 	default:
-		log.Fatal(fmt.Sprintf("[WARN]: not supported connection source/target type : %s", handType))
+		return false, fmt.Errorf("Not supported connection source/target type: %s", handType)
 	}
-	return nil
 }
 
-func (c *Client) StartConnectionHand(connectionHand *ConnectionHand) error {
+// Starts the component on either end of a connection, remote ports are switched to transmit.
+func (c *Client) StartConnectionHand(ctx context.Context, connectionHand *ConnectionHand) error {
 	handType := connectionHand.Type
 	handId := connectionHand.Id
-	log.Printf("[DEBUG] Start connection hand %s , %d", handType, handId)
+	log.Printf("[DEBUG] Start connection hand %s , %s", handType, handId)
 	switch handType {
 	case "PROCESSOR":
 		processor, err := c.GetProcessor(handId)
 		if err != nil {
-			return c.StartProcessor(processor)
-		} else {
 			return err
 		}
-	case "INPUT_PORT":
-		port, err := c.GetPort(handId, "INPUT_PORT")
-		if err == nil {
-			return c.StartPort(port)
-		} else {
-			return err
+		if "STOPPED" != processor.Component.State {
+			return nil
 		}
-	case "OUTPUT_PORT":
-		port, err := c.GetPort(handId, "OUTPUT_PORT")
-		if err == nil {
-			return c.StartPort(port)
-		} else {
+		return c.StartProcessor(processor)
+	case "INPUT_PORT", "OUTPUT_PORT":
+		port, err := c.GetPort(handId, handType)
+		if err != nil {
 			return err
 		}
+		if "STOPPED" != port.Component.State {
+			return nil
+		}
+		return c.StartPort(ctx, port)
+	case "REMOTE_INPUT_PORT", "REMOTE_OUTPUT_PORT":
+		return c.SetRemoteProcessGroupPortTransmission(connectionHand.GroupId, handType, handId, true)
 	case "FUNNEL":
 		log.Printf("No need to start Funnel")
 		return nil
@@ -969,6 +1901,21 @@ func (c *Client) StartConnectionHand(connectionHand *ConnectionHand) error {
 	return nil
 }
 
+// Components are supposed to run when their resources say so: processors and ports managed as RUNNING
+// and remote ports of remote process groups managed as TRANSMITTING. Components not managed by the plugin
+// are never considered to be supposed to run.
+func (c *Client) IsConnectionHandDesiredRunning(connectionHand *ConnectionHand) bool {
+	switch connectionHand.Type {
+	case "PROCESSOR", "INPUT_PORT", "OUTPUT_PORT":
+		runStatus, ok := c.GetDesiredRunStatus(connectionHand.Id)
+		return ok && "RUNNING" == runStatus
+	case "REMOTE_INPUT_PORT", "REMOTE_OUTPUT_PORT":
+		runStatus, ok := c.GetDesiredRunStatus(connectionHand.GroupId)
+		return ok && "TRANSMITTING" == runStatus
+	}
+	return false
+}
+
 //Funnel
 type FunnelComponent struct {
 	Id            string   `json:"id,omitempty"`
@@ -1033,6 +1980,8 @@ type ReportingTaskComponent struct {
 	Comments           string                 `json:"comments"`
 	SchedulingStrategy string                 `json:"schedulingStrategy"`
 	SchedulingPeriod   string                 `json:"schedulingPeriod"`
+	State              string                 `json:"state,omitempty"`
+	ActiveThreadCount  int                    `json:"activeThreadCount,omitempty"`
 	Properties         map[string]interface{} `json:"properties"`
 }
 
@@ -1084,3 +2033,55 @@ func (c *Client) DeleteReportingTask(reportingTask *ReportingTask) error {
 	_, err := c.JsonCall("DELETE", url, nil, nil)
 	return err
 }
+
+func (c *Client) SetReportingTaskState(reportingTask *ReportingTask, state string) error {
+	stateUpdate := map[string]interface{}{
+		"revision": Revision{
+			Version: reportingTask.Revision.Version,
+		},
+		"state": state,
+	}
+	url := fmt.Sprintf("%s://%s/%s/reporting-tasks/%s/run-status",
+		c.HttpScheme, c.Config.Host, c.Config.ApiPath, reportingTask.Component.Id)
+	_, err := c.JsonCall("PUT", url, stateUpdate, reportingTask)
+	if nil != err {
+		return err
+	}
+	c.CleanupNilProperties(reportingTask.Component.Properties)
+	return nil
+}
+
+func (c *Client) StartReportingTask(reportingTask *ReportingTask) error {
+	return c.SetReportingTaskState(reportingTask, "RUNNING")
+}
+
+func (c *Client) StopReportingTask(reportingTask *ReportingTask) error {
+	return c.SetReportingTaskState(reportingTask, "STOPPED")
+}
+
+func (c *Client) DisableReportingTask(reportingTask *ReportingTask) error {
+	return c.SetReportingTaskState(reportingTask, "DISABLED")
+}
+
+// Stopped reporting tasks may still have threads finishing their last run, the task is considered
+// to be in the desired state once all of those are done.
+func (c *Client) WaitForReportingTaskState(ctx context.Context, reportingTask *ReportingTask, state string) error {
+	return c.WaitForAsyncRequest(ctx, AsyncRequest{
+		Name: fmt.Sprintf("Reporting Task %s to become %s", reportingTask.Component.Id, state),
+		Poll: func() (AsyncRequestStatus, error) {
+			refreshed, err := c.GetReportingTask(reportingTask.Component.Id)
+			if nil != err {
+				return AsyncRequestStatus{}, err
+			}
+			*reportingTask = *refreshed
+			finished := state == refreshed.Component.State
+			if "RUNNING" != state && refreshed.Component.ActiveThreadCount > 0 {
+				finished = false
+			}
+			return AsyncRequestStatus{
+				Finished: finished,
+				State:    refreshed.Component.State,
+			}, nil
+		},
+	})
+}
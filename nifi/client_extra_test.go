@@ -1,6 +1,7 @@
 package nifi
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -233,6 +234,12 @@ func TestClientRemoteProcessGroupCreate(t *testing.T) {
 	processGroup.Component.Name = "test_remote_pg2"
 	err = client.UpdateRemoteProcessGroup(&processGroup)
 	assert.Equal(t, err, nil)
+
+	err = client.DeleteRemoteProcessGroup(&processGroup)
+	assert.Equal(t, err, nil)
+
+	_, err = client.GetRemoteProcessGroup(processGroup.Component.Id)
+	assert.Equal(t, "not_found", err.Error())
 }
 
 func TestClientInputPortCreate(t *testing.T) {
@@ -281,12 +288,12 @@ func TestClientOutputPortStop(t *testing.T) {
 	client := NewClient(config)
 	port, error := client.GetPort("cefbdfcc-015e-1000-c243-99e6d5e08d92", "OUTPUT_PORT")
 	log.Printf(fmt.Sprintf("Error: %s", error))
-	error = client.StopPort(port)
+	error = client.StopPort(context.Background(), port)
 	log.Printf(fmt.Sprintf("Error: %s", error))
 	// time.Sleep(time.Second * 2)
-	// error = client.StartPort(port)
+	// error = client.StartPort(context.Background(), port)
 	// log.Printf(fmt.Sprintf("Error: %s", error))
 	// time.Sleep(time.Second * 2)
-	// error = client.StopPort(port)
+	// error = client.StopPort(context.Background(), port)
 	// log.Printf(fmt.Sprintf("Error: %s", error))
 }
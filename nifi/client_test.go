@@ -1,7 +1,13 @@
 package nifi
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 )
@@ -300,3 +306,301 @@ func TestClientReportingTaskCreate(t *testing.T) {
 	client.DeleteProcessGroup(&processGroup)
 	assert.Nil(t, err)
 }
+
+func TestClientAsyncRequestFinished(t *testing.T) {
+	client := NewClient(Config{})
+
+	polls := 0
+	cleanedUp := false
+	err := client.WaitForAsyncRequest(context.Background(), AsyncRequest{
+		Name: "test request",
+		Poll: func() (AsyncRequestStatus, error) {
+			polls++
+			if 1 == polls {
+				return AsyncRequestStatus{}, fmt.Errorf("transient failure")
+			}
+			return AsyncRequestStatus{
+				Finished:         polls == 3,
+				PercentCompleted: polls * 33,
+			}, nil
+		},
+		Cleanup: func() error {
+			cleanedUp = true
+			return nil
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, polls)
+	assert.True(t, cleanedUp)
+}
+
+func TestClientAsyncRequestFailed(t *testing.T) {
+	client := NewClient(Config{})
+
+	cleanedUp := false
+	err := client.WaitForAsyncRequest(context.Background(), AsyncRequest{
+		Name: "test request",
+		Poll: func() (AsyncRequestStatus, error) {
+			return AsyncRequestStatus{Finished: true, FailureReason: "queue is locked"}, nil
+		},
+		Cleanup: func() error {
+			cleanedUp = true
+			return nil
+		},
+	})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "queue is locked")
+	assert.True(t, cleanedUp)
+}
+
+func TestClientAsyncRequestTimeout(t *testing.T) {
+	client := NewClient(Config{})
+
+	cleanedUp := false
+	err := client.WaitForAsyncRequest(context.Background(), AsyncRequest{
+		Name: "test request",
+		Poll: func() (AsyncRequestStatus, error) {
+			return AsyncRequestStatus{PercentCompleted: 50}, nil
+		},
+		Cleanup: func() error {
+			cleanedUp = true
+			return nil
+		},
+		Timeout: 100 * time.Millisecond,
+	})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Timed out")
+	assert.True(t, cleanedUp)
+}
+
+func TestClientAsyncRequestCancelled(t *testing.T) {
+	client := NewClient(Config{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := client.WaitForAsyncRequest(ctx, AsyncRequest{
+		Name: "test request",
+		Poll: func() (AsyncRequestStatus, error) {
+			return AsyncRequestStatus{}, nil
+		},
+	})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Cancelled")
+}
+
+func TestClientAsyncRequestDeadline(t *testing.T) {
+	client := NewClient(Config{})
+
+	// Deadline of the context applies when the request has no timeout of its own
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := client.WaitForAsyncRequest(ctx, AsyncRequest{
+		Name: "test request",
+		Poll: func() (AsyncRequestStatus, error) {
+			return AsyncRequestStatus{}, nil
+		},
+	})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Timed out")
+}
+
+func TestClientPortStateConflict(t *testing.T) {
+	state := "STOPPED"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if "PUT" == r.Method {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		port := Port{}
+		port.Component.Id = "port1"
+		port.Component.PortType = "INPUT_PORT"
+		port.Component.State = state
+		json.NewEncoder(w).Encode(port)
+	}))
+	defer server.Close()
+
+	client := NewClient(Config{
+		Host:       server.Listener.Addr().String(),
+		ApiPath:    "nifi-api",
+		HttpScheme: "http",
+	})
+	port := Port{}
+	port.Component.Id = "port1"
+	port.Component.PortType = "INPUT_PORT"
+
+	// Port is already stopped
+	err := client.StopPort(context.Background(), &port)
+	assert.Nil(t, err)
+
+	// NiFi refused to start the port
+	err = client.StartPort(context.Background(), &port)
+	assert.NotNil(t, err)
+}
+
+func TestClientConnectionListData(t *testing.T) {
+	calls := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		listingRequest := ConnectionListingRequest{}
+		listingRequest.ListingRequest.Id = "listing1"
+		listingRequest.ListingRequest.Finished = "GET" == r.Method
+		if listingRequest.ListingRequest.Finished {
+			listingRequest.ListingRequest.FlowFileSummaries = []FlowFileSummary{{Uuid: "ff1", Filename: "a.txt", Size: 42}}
+		}
+		json.NewEncoder(w).Encode(listingRequest)
+	}))
+	defer server.Close()
+
+	client := NewClient(Config{
+		Host:       server.Listener.Addr().String(),
+		ApiPath:    "nifi-api",
+		HttpScheme: "http",
+	})
+	connection := Connection{}
+	connection.Component.Id = "conn1"
+	summaries, err := client.ListConnectionData(context.Background(), &connection)
+	assert.Nil(t, err)
+	assert.Equal(t, []FlowFileSummary{{Uuid: "ff1", Filename: "a.txt", Size: 42}}, summaries)
+	assert.Equal(t, []string{
+		"POST /nifi-api/flowfile-queues/conn1/listing-requests",
+		"GET /nifi-api/flowfile-queues/conn1/listing-requests/listing1",
+		"DELETE /nifi-api/flowfile-queues/conn1/listing-requests/listing1",
+	}, calls)
+}
+
+func TestProcessGroupScheduledComponents(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/nifi-api/process-groups/pg1/processors":
+			processors := ProcessGroupProcessors{Processors: []Processor{{}, {}}}
+			processors.Processors[0].Component.Id = "running"
+			processors.Processors[1].Component.Id = "stopped"
+			json.NewEncoder(w).Encode(processors)
+		case "/nifi-api/process-groups/pg1/input-ports":
+			ports := ProcessGroupPorts{InputPorts: []Port{{}}}
+			ports.InputPorts[0].Component.Id = "port"
+			json.NewEncoder(w).Encode(ports)
+		default:
+			w.Write([]byte("{}"))
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(Config{
+		Host:       server.Listener.Addr().String(),
+		ApiPath:    "nifi-api",
+		HttpScheme: "http",
+	})
+
+	// Everything is scheduled unless some processors are supposed to stay stopped
+	components, kept, err := ProcessGroupScheduledComponents(client, "pg1")
+	assert.Nil(t, err)
+	assert.Nil(t, components)
+	assert.Equal(t, 0, kept)
+
+	client.SetDesiredRunStatus("running", "RUNNING")
+	client.SetDesiredRunStatus("stopped", "STOPPED")
+	components, kept, err = ProcessGroupScheduledComponents(client, "pg1")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]Revision{"running": {}, "port": {}}, components)
+	assert.Equal(t, 1, kept)
+}
+
+func TestConnectionReplaceOnRejectedDestination(t *testing.T) {
+	calls := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := r.Method + " " + r.URL.Path
+		calls = append(calls, call)
+		switch call {
+		case "PUT /nifi-api/connections/conn1":
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte("Cannot change destination of Connection because FlowFiles from this Connection are currently held by proc2"))
+		case "GET /nifi-api/connections/conn1":
+			connection := Connection{}
+			connection.Component.Id = "conn1"
+			json.NewEncoder(w).Encode(connection)
+		case "POST /nifi-api/flowfile-queues/conn1/drop-requests",
+			"GET /nifi-api/flowfile-queues/conn1/drop-requests/drop1":
+			dropRequest := ConnectionDropRequest{}
+			dropRequest.DropRequest.Id = "drop1"
+			dropRequest.DropRequest.Finished = true
+			json.NewEncoder(w).Encode(dropRequest)
+		case "POST /nifi-api/process-groups/pg1/connections":
+			connection := Connection{}
+			json.NewDecoder(r.Body).Decode(&connection)
+			connection.Component.Id = "conn2"
+			json.NewEncoder(w).Encode(connection)
+		default:
+			w.Write([]byte("{}"))
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(Config{
+		Host:       server.Listener.Addr().String(),
+		ApiPath:    "nifi-api",
+		HttpScheme: "http",
+	})
+	connection := Connection{}
+	connection.Component.Id = "conn1"
+	connection.Component.ParentGroupId = "pg1"
+	connection.Component.Destination = ConnectionHand{Type: "PROCESSOR", Id: "proc3", GroupId: "pg1"}
+
+	rejected, err := client.TryUpdateConnection(&connection)
+	assert.NotNil(t, err)
+	assert.True(t, rejected)
+
+	err = ConnectionReplace(context.Background(), client, &connection, "drop")
+	assert.Nil(t, err)
+	assert.Equal(t, "conn2", connection.Component.Id)
+	assert.Equal(t, "proc3", connection.Component.Destination.Id)
+	assert.Contains(t, calls, "DELETE /nifi-api/flowfile-queues/conn1/drop-requests/drop1")
+	assert.Contains(t, calls, "DELETE /nifi-api/connections/conn1")
+}
+
+func TestClientMoveComponentConnections(t *testing.T) {
+	snippets := []string{}
+	outerConnection := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /nifi-api/process-groups/parent/connections":
+			connections := Connections{Connections: []Connection{{}, {}}}
+			connections.Connections[0].Component.Id = "inner"
+			connections.Connections[0].Component.Source = ConnectionHand{Id: "out", GroupId: "pg1"}
+			connections.Connections[0].Component.Destination = ConnectionHand{Id: "in", GroupId: "pg1"}
+			connections.Connections[1].Component.Id = "outer"
+			connections.Connections[1].Component.Source = ConnectionHand{Id: "proc1", GroupId: "parent"}
+			connections.Connections[1].Component.Destination = ConnectionHand{Id: "in", GroupId: "pg1"}
+			if !outerConnection {
+				connections.Connections = connections.Connections[:1]
+			}
+			json.NewEncoder(w).Encode(connections)
+		case "POST /nifi-api/snippets":
+			body, _ := ioutil.ReadAll(r.Body)
+			snippets = append(snippets, string(body))
+			w.Write([]byte(`{"snippet":{"id":"snippet1"}}`))
+		default:
+			w.Write([]byte("{}"))
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(Config{
+		Host:       server.Listener.Addr().String(),
+		ApiPath:    "nifi-api",
+		HttpScheme: "http",
+	})
+
+	// Connections to components staying behind block the move
+	err := client.MoveComponent("processGroups", "pg1", Revision{}, "parent", "target")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "outer")
+	assert.Empty(t, snippets)
+
+	// Connections between ports of the moved group are moved along with it
+	outerConnection = false
+	err = client.MoveComponent("processGroups", "pg1", Revision{}, "parent", "target")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(snippets))
+	assert.Contains(t, snippets[0], `"inner"`)
+}
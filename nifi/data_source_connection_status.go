@@ -0,0 +1,145 @@
+package nifi
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func DataSourceConnectionStatus() *schema.Resource {
+	return &schema.Resource{
+		Read: DataSourceConnectionStatusRead,
+
+		Schema: map[string]*schema.Schema{
+			"connection_id": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"queued_count": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"queued_bytes": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"flowfiles_in": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"bytes_in": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"flowfiles_out": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"bytes_out": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"percent_use_count": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"percent_use_bytes": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"list_flowfiles": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"flowfiles": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"uuid": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"filename": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"position": {
+							Type:     schema.TypeInt,
+							Computed: true,
+						},
+						"size": {
+							Type:     schema.TypeInt,
+							Computed: true,
+						},
+						"queued_duration": {
+							Type:     schema.TypeInt,
+							Computed: true,
+						},
+						"lineage_duration": {
+							Type:     schema.TypeInt,
+							Computed: true,
+						},
+						"penalized": {
+							Type:     schema.TypeBool,
+							Computed: true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func DataSourceConnectionStatusRead(d *schema.ResourceData, meta interface{}) error {
+	connectionId := d.Get("connection_id").(string)
+
+	client := meta.(*Client)
+	status, err := client.GetConnectionStatus(connectionId)
+	if err != nil {
+		return fmt.Errorf("Error retrieving Connection status: %s", connectionId)
+	}
+
+	// Input and output figures cover the last 5 minutes
+	snapshot := status.ConnectionStatus.AggregateSnapshot
+	d.SetId(connectionId)
+	d.Set("queued_count", snapshot.FlowFilesQueued)
+	d.Set("queued_bytes", int(snapshot.BytesQueued))
+	d.Set("flowfiles_in", snapshot.FlowFilesIn)
+	d.Set("bytes_in", int(snapshot.BytesIn))
+	d.Set("flowfiles_out", snapshot.FlowFilesOut)
+	d.Set("bytes_out", int(snapshot.BytesOut))
+	d.Set("percent_use_count", snapshot.PercentUseCount)
+	d.Set("percent_use_bytes", snapshot.PercentUseBytes)
+
+	// Queue listing is opt-in, NiFi has to walk the queue to build it
+	flowFiles := []interface{}{}
+	if d.Get("list_flowfiles").(bool) {
+		connection, err := client.GetConnection(connectionId)
+		if err != nil {
+			return fmt.Errorf("Error retrieving Connection: %s", connectionId)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutRead))
+		defer cancel()
+		summaries, err := client.ListConnectionData(ctx, connection)
+		if err != nil {
+			return fmt.Errorf("Failed to list Connection data: %s, %s", connectionId, err)
+		}
+		for _, summary := range summaries {
+			flowFiles = append(flowFiles, map[string]interface{}{
+				"uuid":             summary.Uuid,
+				"filename":         summary.Filename,
+				"position":         summary.Position,
+				"size":             int(summary.Size),
+				"queued_duration":  int(summary.QueuedDuration),
+				"lineage_duration": int(summary.LineageDuration),
+				"penalized":        summary.Penalized,
+			})
+		}
+	}
+	d.Set("flowfiles", flowFiles)
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package nifi
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func DataSourceProcessorState() *schema.Resource {
+	return &schema.Resource{
+		Read: DataSourceProcessorStateRead,
+
+		Schema: map[string]*schema.Schema{
+			"processor_id": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"state_description": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"local_state":   SchemaStateEntries(),
+			"cluster_state": SchemaStateEntries(),
+		},
+	}
+}
+
+func DataSourceProcessorStateRead(d *schema.ResourceData, meta interface{}) error {
+	processorId := d.Get("processor_id").(string)
+
+	client := meta.(*Client)
+	state, err := client.GetProcessorState(processorId)
+	if err != nil {
+		return fmt.Errorf("Error retrieving Processor state: %s", processorId)
+	}
+
+	d.SetId(processorId)
+	d.Set("state_description", state.ComponentState.StateDescription)
+	d.Set("local_state", StateEntriesToSchema(state.ComponentState.LocalState))
+	d.Set("cluster_state", StateEntriesToSchema(state.ComponentState.ClusterState))
+
+	return nil
+}
+
+// Schema Helpers
+
+func SchemaStateEntries() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Computed: true,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"key": {
+					Type:     schema.TypeString,
+					Computed: true,
+				},
+				"value": {
+					Type:     schema.TypeString,
+					Computed: true,
+				},
+				"cluster_node_id": {
+					Type:     schema.TypeString,
+					Computed: true,
+				},
+				"cluster_node_address": {
+					Type:     schema.TypeString,
+					Computed: true,
+				},
+			},
+		},
+	}
+}
+
+func StateEntriesToSchema(stateMap *StateMap) []interface{} {
+	entries := []interface{}{}
+	if nil == stateMap {
+		return entries
+	}
+	for _, v := range stateMap.State {
+		entries = append(entries, map[string]interface{}{
+			"key":                  v.Key,
+			"value":                v.Value,
+			"cluster_node_id":      v.ClusterNodeId,
+			"cluster_node_address": v.ClusterNodeAddress,
+		})
+	}
+	return entries
+}
@@ -49,6 +49,11 @@ func Provider() terraform.ResourceProvider {
 			"nifi_reporting_task":       ResourceReportingTask(),
 		},
 
+		DataSourcesMap: map[string]*schema.Resource{
+			"nifi_processor_state":   DataSourceProcessorState(),
+			"nifi_connection_status": DataSourceConnectionStatus(),
+		},
+
 		ConfigureFunc: providerConfigure,
 	}
 }
@@ -1,12 +1,34 @@
 package nifi
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/terraform/helper/schema"
 )
 
+// Prioritizers shipped with NiFi
+var ConnectionPrioritizers = []string{
+	"org.apache.nifi.prioritizer.FirstInFirstOutPrioritizer",
+	"org.apache.nifi.prioritizer.NewestFlowFileFirstPrioritizer",
+	"org.apache.nifi.prioritizer.OldestFlowFileFirstPrioritizer",
+	"org.apache.nifi.prioritizer.PriorityAttributePrioritizer",
+}
+
+// Prioritizers may come from custom NARs as well, unknown classes only produce a warning.
+func ConnectionValidatePrioritizer(v interface{}, k string) ([]string, []error) {
+	value := v.(string)
+	for _, s := range ConnectionPrioritizers {
+		if s == value {
+			return nil, nil
+		}
+	}
+	return []string{fmt.Sprintf("%s is not a prioritizer shipped with NiFi, it has to be provided by a custom NAR: %s", k, value)}, nil
+}
+
 func ResourceConnection() *schema.Resource {
 	return &schema.Resource{
 		Create: ResourceConnectionCreate,
@@ -15,9 +37,15 @@ func ResourceConnection() *schema.Resource {
 		Delete: ResourceConnectionDelete,
 		Exists: ResourceConnectionExists,
 
+		Timeouts: &schema.ResourceTimeout{
+			Update: schema.DefaultTimeout(10 * time.Minute),
+			Delete: schema.DefaultTimeout(10 * time.Minute),
+		},
+
 		Schema: map[string]*schema.Schema{
 			"parent_group_id": SchemaParentGroupId(),
 			"revision":        SchemaRevision(),
+			"delete_strategy": SchemaDeleteStrategy(),
 			"component": {
 				Type:     schema.TypeList,
 				Required: true,
@@ -30,29 +58,76 @@ func ResourceConnection() *schema.Resource {
 						"back_pressure_data_size_threshold": {
 							Type:     schema.TypeString,
 							Optional: true,
-							Default: "1 GB",
+							Default:  "1 GB",
 						},
 						"back_pressure_object_threshold": {
 							Type:     schema.TypeInt,
 							Optional: true,
-							Default: 10000,
+							Default:  10000,
+						},
+						"name": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"flowfile_expiration": {
+							Type:     schema.TypeString,
+							Optional: true,
+							Default:  "0 sec",
+						},
+						"prioritizers": {
+							Type:     schema.TypeList,
+							Optional: true,
+							Elem: &schema.Schema{
+								Type:         schema.TypeString,
+								ValidateFunc: ConnectionValidatePrioritizer,
+							},
+						},
+						"load_balance_strategy": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							Computed:     true,
+							ValidateFunc: ValidateStringInSlice([]string{"DO_NOT_LOAD_BALANCE", "PARTITION_BY_ATTRIBUTE", "ROUND_ROBIN", "SINGLE_NODE"}),
+						},
+						"load_balance_partition_attribute": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"load_balance_compression": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							Computed:     true,
+							ValidateFunc: ValidateStringInSlice([]string{"DO_NOT_COMPRESS", "COMPRESS_ATTRIBUTES_ONLY", "COMPRESS_ATTRIBUTES_AND_CONTENT"}),
+						},
+						"label_index": {
+							Type:     schema.TypeInt,
+							Optional: true,
+							Default:  1,
+						},
+						"z_index": {
+							Type:     schema.TypeInt,
+							Optional: true,
+							Default:  0,
 						},
 						"source": {
 							Type:     schema.TypeList,
 							Required: true,
 							Elem: &schema.Resource{
+								// NiFi does not allow changing connection's source
 								Schema: map[string]*schema.Schema{
 									"type": {
 										Type:     schema.TypeString,
 										Required: true,
+										ForceNew: true,
 									},
 									"id": {
 										Type:     schema.TypeString,
 										Required: true,
+										ForceNew: true,
 									},
 									"group_id": {
 										Type:     schema.TypeString,
 										Required: true,
+										ForceNew: true,
 									},
 								},
 							},
@@ -116,12 +191,22 @@ func ResourceConnectionCreate(d *schema.ResourceData, meta interface{}) error {
 
 	// Create connection
 	client := meta.(*Client)
+	err = ConnectionResolveRemoteHands(client, &connection)
+	if err != nil {
+		return err
+	}
+	err = ConnectionValidate(client, &connection)
+	if err != nil {
+		return err
+	}
 	err = client.CreateConnection(&connection)
 	if err != nil {
 		return fmt.Errorf("Failed to create Connection %s", err)
 	}
-	client.StartConnectionHand(&connection.Component.Source)
-	client.StartConnectionHand(&connection.Component.Destination)
+	// Components that are supposed to run may have been waiting for the connection
+	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutCreate))
+	defer cancel()
+	ConnectionStartDesiredHands(ctx, client, &connection)
 	// Indicate successful creation
 	d.SetId(connection.Component.Id)
 	d.Set("parent_group_id", parentGroupId)
@@ -137,8 +222,9 @@ func ResourceConnectionRead(d *schema.ResourceData, meta interface{}) error {
 	if err != nil {
 		return fmt.Errorf("Error retrieving Connection: %s", connectionId)
 	}
+	client.SetConnectionManaged(connectionId)
 
-	err = ConnectionToSchema(d, connection)
+	err = ConnectionToSchema(client, d, connection)
 	if err != nil {
 		return fmt.Errorf("Failed to serialize Connection: %s", connectionId)
 	}
@@ -175,30 +261,77 @@ func ResourceConnectionUpdateInternal(d *schema.ResourceData, meta interface{})
 		}
 	}
 
-	// Stop related processors
-	err = client.StopConnectionHand(&connection.Component.Source)
+	source := connection.Component.Source
+	previousDestination := connection.Component.Destination
+
+	// Validate desired state before anything is stopped
+	err = ConnectionFromSchema(d, connection)
 	if err != nil {
-		return fmt.Errorf("Failed to stop source Processor: %s", connection.Component.Source.Id)
+		return fmt.Errorf("Failed to parse Connection schema: %s", connectionId)
 	}
-	err = client.StopConnectionHand(&connection.Component.Destination)
+	err = ConnectionResolveRemoteHands(client, connection)
 	if err != nil {
-		return fmt.Errorf("Failed to stop destination Processor: %s", connection.Component.Destination.Id)
+		return err
+	}
+	err = ConnectionValidate(client, connection)
+	if err != nil {
+		return err
 	}
 
-	// Update connection
-	err = ConnectionFromSchema(d, connection)
+	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutUpdate))
+	defer cancel()
+
+	// Stop related processors, only the ones that were running are started again
+	stopped := []ConnectionHand{}
+	sourceRunning, err := client.StopConnectionHand(ctx, &source)
 	if err != nil {
-		return fmt.Errorf("Failed to parse Connection schema: %s", connectionId)
+		return fmt.Errorf("Failed to stop source Processor: %s", source.Id)
+	}
+	if sourceRunning {
+		stopped = append(stopped, source)
 	}
-	err = client.UpdateConnection(connection)
+	previousDestinationRunning, err := client.StopConnectionHand(ctx, &previousDestination)
 	if err != nil {
-		return fmt.Errorf("Failed to update Connection: %s", connectionId)
+		ConnectionStartHands(ctx, client, stopped)
+		return fmt.Errorf("Failed to stop destination Processor: %s", previousDestination.Id)
+	}
+	if previousDestinationRunning {
+		stopped = append(stopped, previousDestination)
 	}
 
-	// Start related processors
+	// NiFi allows re-pointing an empty connection to a new destination, both destinations have to be stopped
+	destination := connection.Component.Destination
+	destinationChanged := destination.Id != previousDestination.Id || destination.Type != previousDestination.Type
+	if destinationChanged {
+		log.Printf("[INFO] Changing Connection %s destination from %s to %s", connectionId, previousDestination.Id, destination.Id)
+		destinationRunning, stopErr := client.StopConnectionHand(ctx, &destination)
+		if stopErr != nil {
+			err = fmt.Errorf("Failed to stop destination Processor: %s", destination.Id)
+		} else if destinationRunning {
+			stopped = append(stopped, destination)
+		}
+	}
+	if err == nil {
+		rejected, updateErr := client.TryUpdateConnection(connection)
+		if rejected && destinationChanged {
+			// Fall back to replacement, queued data is handled according to the delete strategy
+			log.Printf("[WARN] NiFi rejected destination change of Connection %s, replacing it: %s", connectionId, updateErr)
+			err = ConnectionReplace(ctx, client, connection, ConnectionDeleteStrategy(d))
+			// Connection id is cleared once the old connection is gone
+			d.SetId(connection.Component.Id)
+			if err != nil {
+				err = fmt.Errorf("Failed to replace Connection %s: %s", connectionId, err)
+			}
+		} else if updateErr != nil {
+			err = fmt.Errorf("Failed to update Connection %s: %s", connectionId, updateErr)
+		}
+	}
 
-	client.StartConnectionHand(&connection.Component.Source)
-	client.StartConnectionHand(&connection.Component.Destination)
+	// Start related processors, regardless of the outcome
+	ConnectionStartHands(ctx, client, stopped)
+	if err != nil {
+		return err
+	}
 
 	return ResourceConnectionRead(d, meta)
 }
@@ -233,22 +366,41 @@ func ResourceConnectionDeleteInternal(d *schema.ResourceData, meta interface{})
 	}
 	source := &connection.Component.Source
 	destination := &connection.Component.Destination
+	deleteStrategy := ConnectionDeleteStrategy(d)
+	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutDelete))
+	defer cancel()
+
+	// Refuse to delete a connection that still holds data
+	if "fail_if_not_empty" == deleteStrategy {
+		err = ConnectionEnsureEmpty(client, connectionId)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Stop related processors if it is started
-	err = client.StopConnectionHand(source)
+	stopped := []ConnectionHand{}
+	sourceRunning, err := client.StopConnectionHand(ctx, source)
 	if err != nil {
 		return fmt.Errorf("Failed to stop source Processor: %s", connection.Component.Source.Id)
 	}
-
-	err = client.StopConnectionHand(destination)
+	if sourceRunning {
+		stopped = append(stopped, *source)
+	}
+	destinationRunning, err := client.StopConnectionHand(ctx, destination)
 	if err != nil {
+		ConnectionStartHands(ctx, client, stopped)
 		return fmt.Errorf("Failed to stop destination Processor: %s", connection.Component.Destination.Id)
 	}
+	if destinationRunning {
+		stopped = append(stopped, *destination)
+	}
 
-	// Purge connection data
-	log.Printf("[INFO] Dropping connection data: %d", connection.Revision.Version)
-	err = client.DropConnectionData(connection)
-	if nil != err {
-		return fmt.Errorf("Error purging Connection: %s", connectionId)
+	// Get rid of queued data
+	err = ConnectionPurge(ctx, client, connection, deleteStrategy)
+	if err != nil {
+		ConnectionStartHands(ctx, client, stopped)
+		return err
 	}
 
 	// Delete connection
@@ -259,12 +411,12 @@ func ResourceConnectionDeleteInternal(d *schema.ResourceData, meta interface{})
 	}
 	err = client.DeleteConnection(connection)
 	if err != nil {
+		ConnectionStartHands(ctx, client, stopped)
 		return fmt.Errorf("Error deleting Connection: %s", connectionId)
 	}
 
 	// Start related processors
-	client.StartConnectionHand(source)
-	client.StartConnectionHand(destination)
+	ConnectionStartHands(ctx, client, stopped)
 
 	d.SetId("")
 	return nil
@@ -288,6 +440,286 @@ func ResourceConnectionExists(d *schema.ResourceData, meta interface{}) (bool, e
 	return true, nil
 }
 
+// Deletes the connection and creates it again with its desired settings. Queue is emptied according to
+// the delete strategy first, source and destinations are expected to be stopped.
+func ConnectionReplace(ctx context.Context, client *Client, connection *Connection, deleteStrategy string) error {
+	connectionId := connection.Component.Id
+	current, err := client.GetConnection(connectionId)
+	if err != nil {
+		return err
+	}
+	err = ConnectionPurge(ctx, client, current, deleteStrategy)
+	if err != nil {
+		return err
+	}
+
+	// Revision changes while the queue is being emptied
+	current, err = client.GetConnection(connectionId)
+	if err != nil {
+		return err
+	}
+	err = client.DeleteConnection(current)
+	if err != nil {
+		return err
+	}
+
+	connection.Component.Id = ""
+	connection.Revision = Revision{Version: 0}
+	err = client.CreateConnection(connection)
+	if err != nil {
+		return fmt.Errorf("Connection %s was removed but could not be created again: %s", connectionId, err)
+	}
+	log.Printf("[INFO] Connection %s replaced by %s", connectionId, connection.Component.Id)
+	return nil
+}
+
+// Hand Helpers
+
+// Starts hands that were running before they were stopped, failures are logged only.
+func ConnectionStartHands(ctx context.Context, client *Client, hands []ConnectionHand) {
+	for i := range hands {
+		err := client.StartConnectionHand(ctx, &hands[i])
+		if err != nil {
+			log.Printf("[WARN] Failed to start %s %s: %s", hands[i].Type, hands[i].Id, err)
+		}
+	}
+}
+
+// Starts hands of a new connection that are supposed to run, those may have been invalid without it.
+func ConnectionStartDesiredHands(ctx context.Context, client *Client, connection *Connection) {
+	hands := []ConnectionHand{}
+	for _, hand := range []ConnectionHand{connection.Component.Source, connection.Component.Destination} {
+		if client.IsConnectionHandDesiredRunning(&hand) {
+			hands = append(hands, hand)
+		}
+	}
+	ConnectionStartHands(ctx, client, hands)
+}
+
+// Remote Port Helpers
+
+func ConnectionIsRemoteHand(connectionHand *ConnectionHand) bool {
+	return "REMOTE_INPUT_PORT" == connectionHand.Type || "REMOTE_OUTPUT_PORT" == connectionHand.Type
+}
+
+// Remote ports are resolved against the contents of the remote process group (referenced by hand's group id),
+// which allows them to be referenced by name or target port id.
+func ConnectionResolveRemoteHands(client *Client, connection *Connection) error {
+	for _, hand := range []*ConnectionHand{&connection.Component.Source, &connection.Component.Destination} {
+		if !ConnectionIsRemoteHand(hand) {
+			continue
+		}
+		_, port, err := client.GetRemoteProcessGroupPort(hand.GroupId, hand.Type, hand.Id)
+		if err != nil {
+			return fmt.Errorf("Failed to resolve remote port: %s", err)
+		}
+		hand.Id = port.Id
+	}
+	return nil
+}
+
+// Remote port references (name or target port id) are kept only as long as they resolve to the port NiFi
+// reports for the connection, the reported id is stored otherwise so that drift shows up in the plan.
+func ConnectionRemoteHandReference(client *Client, hand *ConnectionHand, configured []interface{}) string {
+	if !ConnectionIsRemoteHand(hand) || len(configured) != 1 {
+		return hand.Id
+	}
+	reference := configured[0].(map[string]interface{})
+	portRef := reference["id"].(string)
+	if portRef == hand.Id || reference["group_id"].(string) != hand.GroupId || reference["type"].(string) != hand.Type {
+		return hand.Id
+	}
+	_, port, err := client.GetRemoteProcessGroupPort(hand.GroupId, hand.Type, portRef)
+	if err != nil || port.Id != hand.Id {
+		return hand.Id
+	}
+	return portRef
+}
+
+// Validation Helpers
+
+// Catches configuration mistakes prior to submitting a connection, NiFi only responds with an opaque status code.
+func ConnectionValidate(client *Client, connection *Connection) error {
+	source := &connection.Component.Source
+	if "PROCESSOR" == source.Type {
+		processor, err := client.GetProcessor(source.Id)
+		if err != nil {
+			return fmt.Errorf("Error retrieving source Processor: %s", source.Id)
+		}
+		err = ConnectionValidateRelationships(connection, processor)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, hand := range []*ConnectionHand{source, &connection.Component.Destination} {
+		err := ConnectionValidateHandGroup(client, connection, hand)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ConnectionValidateRelationships(connection *Connection, processor *Processor) error {
+	validRelationships := []string{}
+	for _, v := range processor.Component.Relationships {
+		validRelationships = append(validRelationships, v.Name)
+	}
+
+	if 0 == len(connection.Component.SelectedRelationships) {
+		return fmt.Errorf("Connection from Processor %s (%s) requires selected_relationships, valid relationships: %s",
+			processor.Component.Name, processor.Component.Id, strings.Join(validRelationships, ", "))
+	}
+	for _, relationship := range connection.Component.SelectedRelationships {
+		found := false
+		for _, v := range validRelationships {
+			if v == relationship {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("Relationship \"%s\" is not defined by Processor %s (%s), valid relationships: %s",
+				relationship, processor.Component.Name, processor.Component.Id, strings.Join(validRelationships, ", "))
+		}
+	}
+	return nil
+}
+
+func ConnectionValidateHandGroup(client *Client, connection *Connection, hand *ConnectionHand) error {
+	parentGroupId := connection.Component.ParentGroupId
+
+	// Group the component actually belongs to
+	groupId := ""
+	switch hand.Type {
+	case "PROCESSOR":
+		processor, err := client.GetProcessor(hand.Id)
+		if err != nil {
+			return fmt.Errorf("Error retrieving Processor: %s", hand.Id)
+		}
+		groupId = processor.Component.ParentGroupId
+	case "FUNNEL":
+		funnel, err := client.GetFunnel(hand.Id)
+		if err != nil {
+			return fmt.Errorf("Error retrieving Funnel: %s", hand.Id)
+		}
+		groupId = funnel.Component.ParentGroupId
+	case "INPUT_PORT", "OUTPUT_PORT":
+		port, err := client.GetPort(hand.Id, hand.Type)
+		if err != nil {
+			return fmt.Errorf("Error retrieving Port: %s", hand.Id)
+		}
+		groupId = port.Component.ParentGroupId
+	case "REMOTE_INPUT_PORT", "REMOTE_OUTPUT_PORT":
+		processGroup, err := client.GetRemoteProcessGroup(hand.GroupId)
+		if err != nil {
+			return fmt.Errorf("Error retrieving Remote Process Group: %s", hand.GroupId)
+		}
+		if processGroup.Component.ParentGroupId != parentGroupId {
+			return fmt.Errorf("Remote Process Group %s does not belong to Connection's parent group %s",
+				hand.GroupId, parentGroupId)
+		}
+		return nil
+	default:
+		return fmt.Errorf("Not supported connection source/target type: %s", hand.Type)
+	}
+
+	if groupId != hand.GroupId {
+		return fmt.Errorf("%s %s belongs to group %s, not %s", hand.Type, hand.Id, groupId, hand.GroupId)
+	}
+	if groupId == parentGroupId {
+		return nil
+	}
+
+	// Ports of child process groups can be connected from the parent group
+	if "INPUT_PORT" == hand.Type || "OUTPUT_PORT" == hand.Type {
+		processGroup, err := client.GetProcessGroup(groupId)
+		if err != nil {
+			return fmt.Errorf("Error retrieving Process Group: %s", groupId)
+		}
+		if processGroup.Component.ParentGroupId == parentGroupId {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s %s in group %s cannot be connected within Connection's parent group %s",
+		hand.Type, hand.Id, groupId, parentGroupId)
+}
+
+// Queue Helpers
+
+func ConnectionDeleteStrategy(d *schema.ResourceData) string {
+	deleteStrategy := d.Get("delete_strategy").(string)
+	if "" == deleteStrategy {
+		// State written by earlier plugin versions
+		deleteStrategy = "drop"
+	}
+	return deleteStrategy
+}
+
+// Empties connection's queue according to the delete strategy. Source and destination are expected to be stopped.
+func ConnectionPurge(ctx context.Context, client *Client, connection *Connection, deleteStrategy string) error {
+	connectionId := connection.Component.Id
+	switch deleteStrategy {
+	case "fail_if_not_empty":
+		return ConnectionEnsureEmpty(client, connectionId)
+	case "drain":
+		err := ConnectionDrain(ctx, client, connection)
+		if err != nil {
+			return err
+		}
+		_, err = client.StopConnectionHand(ctx, &connection.Component.Destination)
+		if err != nil {
+			return fmt.Errorf("Failed to stop destination Processor: %s", connection.Component.Destination.Id)
+		}
+		return nil
+	default:
+		log.Printf("[INFO] Dropping connection data: %s", connectionId)
+		err := client.DropConnectionData(ctx, connection)
+		if nil != err {
+			return fmt.Errorf("Error purging Connection: %s", connectionId)
+		}
+		return nil
+	}
+}
+
+func ConnectionEnsureEmpty(client *Client, connectionId string) error {
+	status, err := client.GetConnectionStatus(connectionId)
+	if err != nil {
+		return fmt.Errorf("Error retrieving Connection status: %s", connectionId)
+	}
+	queued := status.ConnectionStatus.AggregateSnapshot.FlowFilesQueued
+	if queued > 0 {
+		return fmt.Errorf("Connection %s is not empty: %d FlowFiles queued", connectionId, queued)
+	}
+	return nil
+}
+
+func ConnectionDrain(ctx context.Context, client *Client, connection *Connection) error {
+	connectionId := connection.Component.Id
+
+	// Destination has to keep running in order to drain the queue
+	err := client.StartConnectionHand(ctx, &connection.Component.Destination)
+	if err != nil {
+		return fmt.Errorf("Failed to start destination Processor: %s", connection.Component.Destination.Id)
+	}
+
+	return client.WaitForAsyncRequest(ctx, AsyncRequest{
+		Name: fmt.Sprintf("Connection %s to drain", connectionId),
+		Poll: func() (AsyncRequestStatus, error) {
+			status, err := client.GetConnectionStatus(connectionId)
+			if err != nil {
+				return AsyncRequestStatus{}, err
+			}
+			queued := status.ConnectionStatus.AggregateSnapshot.FlowFilesQueued
+			return AsyncRequestStatus{
+				Finished: 0 == queued,
+				State:    fmt.Sprintf("%d FlowFiles queued", queued),
+			}, nil
+		},
+	})
+}
+
 // Schema Helpers
 
 func ConnectionFromSchema(d *schema.ResourceData, connection *Connection) error {
@@ -300,6 +732,23 @@ func ConnectionFromSchema(d *schema.ResourceData, connection *Connection) error
 
 	connection.Component.BackPressureDataSizeThreshold = component["back_pressure_data_size_threshold"].(string)
 	connection.Component.BackPressureObjectThreshold = component["back_pressure_object_threshold"].(int)
+	connection.Component.Name = component["name"].(string)
+	connection.Component.FlowFileExpiration = component["flowfile_expiration"].(string)
+	connection.Component.LabelIndex = component["label_index"].(int)
+	connection.Component.ZIndex = component["z_index"].(int)
+
+	prioritizers := []string{}
+	for _, v := range component["prioritizers"].([]interface{}) {
+		prioritizers = append(prioritizers, v.(string))
+	}
+	connection.Component.Prioritizers = prioritizers
+
+	connection.Component.LoadBalanceStrategy = component["load_balance_strategy"].(string)
+	connection.Component.LoadBalancePartitionAttribute = component["load_balance_partition_attribute"].(string)
+	connection.Component.LoadBalanceCompression = component["load_balance_compression"].(string)
+	if "PARTITION_BY_ATTRIBUTE" == connection.Component.LoadBalanceStrategy && "" == connection.Component.LoadBalancePartitionAttribute {
+		return fmt.Errorf("component.load_balance_partition_attribute is required by PARTITION_BY_ATTRIBUTE load balance strategy")
+	}
 
 	v = component["source"].([]interface{})
 	if len(v) != 1 {
@@ -342,17 +791,30 @@ func ConnectionFromSchema(d *schema.ResourceData, connection *Connection) error
 	return nil
 }
 
-func ConnectionToSchema(d *schema.ResourceData, connection *Connection) error {
+func ConnectionToSchema(client *Client, d *schema.ResourceData, connection *Connection) error {
 	revision := []map[string]interface{}{{
 		"version": connection.Revision.Version,
 	}}
 	d.Set("revision", revision)
 
+	sourceId := connection.Component.Source.Id
+	destinationId := connection.Component.Destination.Id
+	if v := d.Get("component").([]interface{}); len(v) == 1 {
+		component := v[0].(map[string]interface{})
+		sourceId = ConnectionRemoteHandReference(client, &connection.Component.Source, component["source"].([]interface{}))
+		destinationId = ConnectionRemoteHandReference(client, &connection.Component.Destination, component["destination"].([]interface{}))
+	}
+
 	relationships := []interface{}{}
 	for _, v := range connection.Component.SelectedRelationships {
 		relationships = append(relationships, v)
 	}
 
+	prioritizers := []interface{}{}
+	for _, v := range connection.Component.Prioritizers {
+		prioritizers = append(prioritizers, v)
+	}
+
 	bends := []interface{}{}
 	for _, v := range connection.Component.Bends {
 		bends = append(bends, map[string]interface{}{
@@ -362,17 +824,25 @@ func ConnectionToSchema(d *schema.ResourceData, connection *Connection) error {
 	}
 
 	component := []map[string]interface{}{{
-		"parent_group_id": d.Get("parent_group_id").(string),
+		"parent_group_id":                   d.Get("parent_group_id").(string),
 		"back_pressure_data_size_threshold": connection.Component.BackPressureDataSizeThreshold,
-		"back_pressure_object_threshold": connection.Component.BackPressureObjectThreshold,
+		"back_pressure_object_threshold":    connection.Component.BackPressureObjectThreshold,
+		"name":                              connection.Component.Name,
+		"flowfile_expiration":               connection.Component.FlowFileExpiration,
+		"prioritizers":                      prioritizers,
+		"load_balance_strategy":             connection.Component.LoadBalanceStrategy,
+		"load_balance_partition_attribute":  connection.Component.LoadBalancePartitionAttribute,
+		"load_balance_compression":          connection.Component.LoadBalanceCompression,
+		"label_index":                       connection.Component.LabelIndex,
+		"z_index":                           connection.Component.ZIndex,
 		"source": []map[string]interface{}{{
 			"type":     connection.Component.Source.Type,
-			"id":       connection.Component.Source.Id,
+			"id":       sourceId,
 			"group_id": connection.Component.Source.GroupId,
 		}},
 		"destination": []map[string]interface{}{{
 			"type":     connection.Component.Destination.Type,
-			"id":       connection.Component.Destination.Id,
+			"id":       destinationId,
 			"group_id": connection.Component.Destination.GroupId,
 		}},
 		"selected_relationships": relationships,
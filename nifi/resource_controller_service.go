@@ -1,9 +1,11 @@
 package nifi
 
 import (
+	"context"
 	"fmt"
 	"github.com/hashicorp/terraform/helper/schema"
 	"log"
+	"time"
 )
 
 func ResourceControllerService() *schema.Resource {
@@ -14,9 +16,26 @@ func ResourceControllerService() *schema.Resource {
 		Delete: ResourceControllerServiceDelete,
 		Exists: ResourceControllerServiceExists,
 
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(10 * time.Minute),
+			Update: schema.DefaultTimeout(10 * time.Minute),
+		},
+
 		Schema: map[string]*schema.Schema{
 			"parent_group_id": SchemaParentGroupId(),
 			"revision":        SchemaRevision(),
+			"scope": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				Default:      "PROCESS_GROUP",
+				ValidateFunc: ValidateStringInSlice([]string{"PROCESS_GROUP", "CONTROLLER"}),
+			},
+			"wait_for_enabled": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  true,
+			},
 			"component": {
 				Type:     schema.TypeList,
 				Required: true,
@@ -24,7 +43,7 @@ func ResourceControllerService() *schema.Resource {
 					Schema: map[string]*schema.Schema{
 						"parent_group_id": {
 							Type:     schema.TypeString,
-							Required: true,
+							Optional: true,
 						},
 						"name": {
 							Type:     schema.TypeString,
@@ -38,6 +57,12 @@ func ResourceControllerService() *schema.Resource {
 							Type:     schema.TypeMap,
 							Required: true,
 						},
+						"state": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							Default:      "ENABLED",
+							ValidateFunc: ValidateStringInSlice([]string{"ENABLED", "DISABLED"}),
+						},
 					},
 				},
 			},
@@ -51,7 +76,7 @@ func ResourceControllerServiceCreate(d *schema.ResourceData, meta interface{}) e
 
 	err := ControllerServiceFromSchema(d, &controllerService)
 	if err != nil {
-		return fmt.Errorf("Failed to parse Controller Service schema")
+		return fmt.Errorf("Failed to parse Controller Service schema: %s", err)
 	}
 	parentGroupId := controllerService.Component.ParentGroupId
 
@@ -61,13 +86,23 @@ func ResourceControllerServiceCreate(d *schema.ResourceData, meta interface{}) e
 		return fmt.Errorf("Failed to create Controller Service")
 	}
 
-	err = client.EnableControllerService(&controllerService)
-	if nil != err {
-		log.Printf("[INFO] Failed to enable Controller Service: %s", controllerService.Component.Id)
-	}
-
 	d.SetId(controllerService.Component.Id)
 	d.Set("parent_group_id", parentGroupId)
+	client.SetDesiredRunStatus(controllerService.Component.Id, ControllerServiceStateFromSchema(d))
+
+	if "ENABLED" == ControllerServiceStateFromSchema(d) {
+		ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutCreate))
+		defer cancel()
+		waitForEnabled := d.Get("wait_for_enabled").(bool)
+		err = ControllerServiceEnable(ctx, client, &controllerService, waitForEnabled)
+		if nil != err {
+			if waitForEnabled {
+				ResourceControllerServiceRead(d, meta)
+				return fmt.Errorf("Failed to enable Controller Service %s: %s", controllerService.Component.Id, err)
+			}
+			log.Printf("[INFO] Failed to enable Controller Service: %s", controllerService.Component.Id)
+		}
+	}
 
 	return ResourceControllerServiceRead(d, meta)
 }
@@ -81,6 +116,9 @@ func ResourceControllerServiceRead(d *schema.ResourceData, meta interface{}) err
 		return fmt.Errorf("Error retrieving Controller Service: %s", controllerServiceId)
 	}
 
+	// Process group run status changes leave services managed as ENABLED alone
+	client.SetDesiredRunStatus(controllerServiceId, ControllerServiceStateFromSchema(d))
+
 	err = ControllerServiceToSchema(d, controllerService)
 	if err != nil {
 		return fmt.Errorf("Failed to serialize Controller Service: %s", controllerServiceId)
@@ -90,6 +128,16 @@ func ResourceControllerServiceRead(d *schema.ResourceData, meta interface{}) err
 }
 
 func ResourceControllerServiceUpdate(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Client)
+	client.Lock.Lock()
+	log.Printf("[INFO] Updating Controller Service: %s...", d.Id())
+	err := ResourceControllerServiceUpdateInternal(d, meta)
+	log.Printf("[INFO] Controller Service updated: %s", d.Id())
+	defer client.Lock.Unlock()
+	return err
+}
+
+func ResourceControllerServiceUpdateInternal(d *schema.ResourceData, meta interface{}) error {
 	controllerServiceId := d.Id()
 
 	client := meta.(*Client)
@@ -103,10 +151,25 @@ func ResourceControllerServiceUpdate(d *schema.ResourceData, meta interface{}) e
 		}
 	}
 
-	if "ENABLED" == controllerService.Component.State {
+	client.SetDesiredRunStatus(controllerServiceId, ControllerServiceStateFromSchema(d))
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutUpdate))
+	defer cancel()
+
+	// NiFi refuses to disable a controller service while referencing components are running
+	references, err := ControllerServiceReleaseReferences(ctx, client, controllerServiceId)
+	if err != nil {
+		return fmt.Errorf("Failed to stop components referencing Controller Service: %s", controllerServiceId)
+	}
+
+	if "ENABLED" == controllerService.Component.State || "ENABLING" == controllerService.Component.State {
 		err = client.DisableControllerService(controllerService)
 		if err != nil {
-			return fmt.Errorf("Failed to disable Controller Service: %s", controllerService)
+			return fmt.Errorf("Failed to disable Controller Service: %s", controllerServiceId)
+		}
+		err = client.WaitForControllerServiceState(ctx, controllerService, "DISABLED")
+		if err != nil {
+			return fmt.Errorf("Failed to disable Controller Service: %s", controllerServiceId)
 		}
 	}
 
@@ -119,9 +182,31 @@ func ResourceControllerServiceUpdate(d *schema.ResourceData, meta interface{}) e
 		return fmt.Errorf("Failed to update Controller Service: %s", controllerServiceId)
 	}
 
-	err = client.EnableControllerService(controllerService)
+	// Referencing components can't run while the service is disabled
+	if "ENABLED" != ControllerServiceStateFromSchema(d) {
+		if len(references) > 0 {
+			log.Printf("[WARN] Components referencing Controller Service %s were left stopped", controllerServiceId)
+		}
+		return ResourceControllerServiceRead(d, meta)
+	}
+
+	// Referencing components can only be restarted once the service is enabled
+	waitForEnabled := d.Get("wait_for_enabled").(bool)
+	err = ControllerServiceEnable(ctx, client, controllerService, waitForEnabled || len(references) > 0)
 	if nil != err {
-		log.Printf("[INFO] Failed to enable Controller Service: %s", controllerServiceId)
+		ResourceControllerServiceRead(d, meta)
+		if len(references) > 0 {
+			return fmt.Errorf("Failed to enable Controller Service %s, referencing components were left stopped: %s",
+				controllerServiceId, err)
+		}
+		return fmt.Errorf("Failed to enable Controller Service %s: %s", controllerServiceId, err)
+	}
+
+	// Bring referencing components back to their previous states
+	err = ControllerServiceRestoreReferences(ctx, client, controllerServiceId, references)
+	if err != nil {
+		ResourceControllerServiceRead(d, meta)
+		return fmt.Errorf("Failed to restart components referencing Controller Service %s: %s", controllerServiceId, err)
 	}
 
 	return ResourceControllerServiceRead(d, meta)
@@ -177,7 +262,15 @@ func ControllerServiceFromSchema(d *schema.ResourceData, controllerService *Cont
 		return fmt.Errorf("Exactly one component is required")
 	}
 	component := v[0].(map[string]interface{})
-	controllerService.Component.ParentGroupId = component["parent_group_id"].(string)
+	parentGroupId := component["parent_group_id"].(string)
+	if "CONTROLLER" == ControllerServiceScope(d) {
+		if "" != parentGroupId {
+			return fmt.Errorf("Controller level services can't have parent group id")
+		}
+	} else if "" == parentGroupId {
+		return fmt.Errorf("Parent group id is required for process group services")
+	}
+	controllerService.Component.ParentGroupId = parentGroupId
 	controllerService.Component.Name = component["name"].(string)
 	controllerService.Component.Type = component["type"].(string)
 
@@ -189,6 +282,27 @@ func ControllerServiceFromSchema(d *schema.ResourceData, controllerService *Cont
 	return nil
 }
 
+func ControllerServiceScope(d *schema.ResourceData) string {
+	scope := d.Get("scope").(string)
+	if "" == scope {
+		return "PROCESS_GROUP"
+	}
+	return scope
+}
+
+func ControllerServiceStateFromSchema(d *schema.ResourceData) string {
+	v := d.Get("component").([]interface{})
+	if len(v) != 1 {
+		return "ENABLED"
+	}
+	component := v[0].(map[string]interface{})
+	state, _ := component["state"].(string)
+	if "" == state {
+		return "ENABLED"
+	}
+	return state
+}
+
 func ControllerServiceToSchema(d *schema.ResourceData, controllerService *ControllerService) error {
 	revision := []map[string]interface{}{{
 		"version": controllerService.Revision.Version,
@@ -200,8 +314,183 @@ func ControllerServiceToSchema(d *schema.ResourceData, controllerService *Contro
 		"name":            controllerService.Component.Name,
 		"type":            controllerService.Component.Type,
 		"properties":      controllerService.Component.Properties,
+		"state":           controllerService.Component.State,
 	}}
 	d.Set("component", component)
 
 	return nil
 }
+
+// State Helpers
+
+func ControllerServiceIsInvalid(controllerService *ControllerService) bool {
+	if "" != controllerService.Component.ValidationStatus {
+		return "INVALID" == controllerService.Component.ValidationStatus
+	}
+	return len(controllerService.Component.ValidationErrors) > 0
+}
+
+// Enables the controller service and optionally waits until NiFi reports it as ENABLED.
+func ControllerServiceEnable(ctx context.Context, client *Client, controllerService *ControllerService, wait bool) error {
+	err := client.EnableControllerService(controllerService)
+	if nil != err || !wait {
+		return err
+	}
+	return client.WaitForControllerServiceState(ctx, controllerService, "ENABLED")
+}
+
+// Referencing Components Helpers
+
+func ControllerServiceReferenceRevisions(references []ControllerServiceReferencingComponentEntity,
+	selected func(ControllerServiceReferencingComponent) bool) map[string]Revision {
+	revisions := map[string]Revision{}
+	for _, reference := range references {
+		if selected(reference.Component) {
+			revisions[reference.Id] = reference.Revision
+		}
+	}
+	return revisions
+}
+
+// Splits active referencing components into running schedulable components and enabled controller services.
+func ControllerServiceActiveReferences(references []ControllerServiceReferencingComponentEntity) (map[string]bool, map[string]bool) {
+	running := map[string]bool{}
+	enabled := map[string]bool{}
+	for _, reference := range references {
+		if "ControllerService" == reference.Component.ReferenceType {
+			if "ENABLED" == reference.Component.State || "ENABLING" == reference.Component.State {
+				enabled[reference.Id] = true
+			}
+		} else if "RUNNING" == reference.Component.State {
+			running[reference.Id] = true
+		}
+	}
+	return running, enabled
+}
+
+func ControllerServiceWaitForReferences(ctx context.Context, client *Client, controllerServiceId string, name string,
+	pending func(ControllerServiceReferencingComponent) bool) ([]ControllerServiceReferencingComponentEntity, error) {
+	var references []ControllerServiceReferencingComponentEntity
+	err := client.WaitForAsyncRequest(ctx, AsyncRequest{
+		Name: fmt.Sprintf("components referencing Controller Service %s to be %s", controllerServiceId, name),
+		Poll: func() (AsyncRequestStatus, error) {
+			var err error
+			references, err = client.GetControllerServiceReferences(controllerServiceId)
+			if nil != err {
+				return AsyncRequestStatus{}, err
+			}
+			remaining := ControllerServiceReferenceRevisions(references, pending)
+			return AsyncRequestStatus{
+				Finished: 0 == len(remaining),
+				State:    fmt.Sprintf("%d remaining", len(remaining)),
+			}, nil
+		},
+	})
+	return references, err
+}
+
+// Stops processors and reporting tasks and disables controller services that reference the controller service.
+// Returns the references as they were before, so that their states can be restored afterwards.
+func ControllerServiceReleaseReferences(ctx context.Context, client *Client, controllerServiceId string) ([]ControllerServiceReferencingComponentEntity, error) {
+	references, err := client.GetControllerServiceReferences(controllerServiceId)
+	if nil != err {
+		return nil, err
+	}
+
+	running, enabled := ControllerServiceActiveReferences(references)
+
+	current := references
+	if len(running) > 0 {
+		log.Printf("[INFO] Stopping %d components referencing Controller Service: %s", len(running), controllerServiceId)
+		err = client.UpdateControllerServiceReferences(controllerServiceId, "STOPPED", current)
+		if nil != err {
+			return nil, err
+		}
+		current, err = ControllerServiceWaitForReferences(ctx, client, controllerServiceId, "stopped",
+			func(component ControllerServiceReferencingComponent) bool {
+				return running[component.Id] && ("RUNNING" == component.State || component.ActiveThreadCount > 0)
+			})
+		if nil != err {
+			return nil, err
+		}
+	}
+
+	if len(enabled) > 0 {
+		log.Printf("[INFO] Disabling %d services referencing Controller Service: %s", len(enabled), controllerServiceId)
+		err = client.UpdateControllerServiceReferences(controllerServiceId, "DISABLED", current)
+		if nil != err {
+			return nil, err
+		}
+		_, err = ControllerServiceWaitForReferences(ctx, client, controllerServiceId, "disabled",
+			func(component ControllerServiceReferencingComponent) bool {
+				return enabled[component.Id] && "DISABLED" != component.State
+			})
+		if nil != err {
+			return nil, err
+		}
+	}
+
+	return references, nil
+}
+
+// Re-enables controller services and restarts processors and reporting tasks that were released
+// by ControllerServiceReleaseReferences. The controller service itself is expected to be enabled.
+// Components are restored one by one, NiFi's references endpoint would also start the ones that were stopped before.
+func ControllerServiceRestoreReferences(ctx context.Context, client *Client, controllerServiceId string, previous []ControllerServiceReferencingComponentEntity) error {
+	running, enabled := ControllerServiceActiveReferences(previous)
+	if 0 == len(running) && 0 == len(enabled) {
+		return nil
+	}
+
+	// References are listed in the dependency order, services referencing other services come later
+	log.Printf("[INFO] Enabling %d services referencing Controller Service: %s", len(enabled), controllerServiceId)
+	for _, reference := range previous {
+		if !enabled[reference.Id] {
+			continue
+		}
+		controllerService, err := client.GetControllerService(reference.Id)
+		if nil != err {
+			return err
+		}
+		if "ENABLED" == controllerService.Component.State {
+			continue
+		}
+		err = ControllerServiceEnable(ctx, client, controllerService, true)
+		if nil != err {
+			return fmt.Errorf("Failed to enable Controller Service %s: %s", reference.Id, err)
+		}
+	}
+
+	log.Printf("[INFO] Starting %d components referencing Controller Service: %s", len(running), controllerServiceId)
+	for _, reference := range previous {
+		if !running[reference.Id] {
+			continue
+		}
+		switch reference.Component.ReferenceType {
+		case "Processor":
+			processor, err := client.GetProcessor(reference.Id)
+			if nil != err {
+				return err
+			}
+			if "RUNNING" != processor.Component.State {
+				err = client.StartProcessor(processor)
+				if nil != err {
+					return fmt.Errorf("Failed to start Processor %s: %s", reference.Id, err)
+				}
+			}
+		case "ReportingTask":
+			reportingTask, err := client.GetReportingTask(reference.Id)
+			if nil != err {
+				return err
+			}
+			if "RUNNING" != reportingTask.Component.State {
+				err = client.StartReportingTask(reportingTask)
+				if nil != err {
+					return fmt.Errorf("Failed to start Reporting Task %s: %s", reference.Id, err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
@@ -99,14 +99,29 @@ func ResourceFunnelUpdateInternal(d *schema.ResourceData, meta interface{}) erro
 	// Refresh funnel details
 	client := meta.(*Client)
 	funnel, err := client.GetFunnel(funnelId)
-	if "not_found" == err.Error() {
-		d.SetId("")
-		return nil
-	}
 	if err != nil {
+		if "not_found" == err.Error() {
+			d.SetId("")
+			return nil
+		}
 		return fmt.Errorf("Error retrieving Funnel: %s", funnelId)
 	}
 
+	// Move funnel to its new parent group
+	parentGroupId := ComponentParentGroupIdFromSchema(d)
+	if parentGroupId != funnel.Component.ParentGroupId {
+		err = client.MoveComponent("funnels", funnelId, funnel.Revision, funnel.Component.ParentGroupId, parentGroupId)
+		if err != nil {
+			return fmt.Errorf("Failed to move Funnel %s to Process Group %s: %s", funnelId, parentGroupId, err)
+		}
+		d.Set("parent_group_id", parentGroupId)
+
+		funnel, err = client.GetFunnel(funnelId)
+		if err != nil {
+			return fmt.Errorf("Error retrieving Funnel: %s", funnelId)
+		}
+	}
+
 	// Load funnel's desired state
 	err = FunnelFromSchema(meta, d, funnel)
 	if err != nil {
@@ -119,7 +134,7 @@ func ResourceFunnelUpdateInternal(d *schema.ResourceData, meta interface{}) erro
 		return fmt.Errorf("Failed to update Funnel: %s", funnelId)
 	}
 
-	return ResourceGroupRead(d, meta)
+	return ResourceFunnelRead(d, meta)
 }
 
 func ResourceFunnelDelete(d *schema.ResourceData, meta interface{}) error {
@@ -1,8 +1,10 @@
 package nifi
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/hashicorp/terraform/helper/schema"
 )
@@ -14,6 +16,17 @@ func ResourcePort() *schema.Resource {
 		Update: ResourcePortUpdate,
 		Delete: ResourcePortDelete,
 		Exists: ResourcePortExists,
+		Importer: &schema.ResourceImporter{
+			State: func(d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+				return []*schema.ResourceData{d}, nil
+			},
+		},
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
+		},
 
 		Schema: map[string]*schema.Schema{
 			"parent_group_id": SchemaParentGroupId(),
@@ -32,14 +45,44 @@ func ResourcePort() *schema.Resource {
 							Required: true,
 						},
 						"type": {
-							Type:     schema.TypeString,
-							Required: true,
+							Type:         schema.TypeString,
+							Required:     true,
+							ForceNew:     true,
+							ValidateFunc: ValidateStringInSlice([]string{"INPUT_PORT", "OUTPUT_PORT"}),
 						},
 						"position": SchemaPosition(),
 						"comments": {
 							Type:     schema.TypeString,
 							Optional: true,
 						},
+						"allow_remote_access": {
+							Type:     schema.TypeBool,
+							Optional: true,
+							Computed: true,
+						},
+						"concurrently_schedulable_task_count": {
+							Type:     schema.TypeInt,
+							Optional: true,
+							Default:  1,
+						},
+						"user_access_control": {
+							Type:     schema.TypeSet,
+							Optional: true,
+							Elem:     &schema.Schema{Type: schema.TypeString},
+							Set:      schema.HashString,
+						},
+						"group_access_control": {
+							Type:     schema.TypeSet,
+							Optional: true,
+							Elem:     &schema.Schema{Type: schema.TypeString},
+							Set:      schema.HashString,
+						},
+						"port_function": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							Computed:     true,
+							ValidateFunc: ValidateStringInSlice([]string{"STANDARD", "FAILURE"}),
+						},
 					},
 				},
 			},
@@ -68,9 +111,14 @@ func ResourcePortCreate(d *schema.ResourceData, meta interface{}) error {
 	d.SetId(port.Component.Id)
 	d.Set("parent_group_id", parentGroupId)
 
+	// Managed ports are supposed to run, input ports are started once they are connected
+	client.SetDesiredRunStatus(port.Component.Id, "RUNNING")
+
 	// Start processor upon creation, cannot start input port when there is no connection
 	if port.Component.PortType == "OUTPUT_PORT" {
-		err = client.StartPort(port)
+		ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutCreate))
+		defer cancel()
+		err = client.StartPort(ctx, port)
 		if nil != err {
 			log.Printf("[INFO] Failed to start Port: %s ", port.Component.Id)
 		}
@@ -81,18 +129,14 @@ func ResourcePortCreate(d *schema.ResourceData, meta interface{}) error {
 
 func ResourcePortRead(d *schema.ResourceData, meta interface{}) error {
 	portId := d.Id()
-	v := d.Get("component").([]interface{})
-	if len(v) != 1 {
-		return fmt.Errorf("Exactly one component is required")
-	}
-	component := v[0].(map[string]interface{})
-	port_type := component["type"].(string)
+	port_type := PortTypeFromSchema(d)
 
 	client := meta.(*Client)
 	port, err := client.GetPort(portId, port_type)
 	if err != nil {
 		return fmt.Errorf("Error retrieving Port: %s", portId)
 	}
+	client.SetDesiredRunStatus(portId, "RUNNING")
 
 	err = PortToSchema(d, port)
 	if err != nil {
@@ -121,12 +165,7 @@ func ResourcePortUpdateInternal(d *schema.ResourceData, meta interface{}) error
 	d.Partial(true)
 
 	portId := d.Id()
-	v := d.Get("component").([]interface{})
-	if len(v) != 1 {
-		return fmt.Errorf("Exactly one component is required")
-	}
-	component := v[0].(map[string]interface{})
-	port_type := component["type"].(string)
+	port_type := PortTypeFromSchema(d)
 	// Refresh processor details
 	client := meta.(*Client)
 	port, err := client.GetPort(portId, port_type)
@@ -135,36 +174,72 @@ func ResourcePortUpdateInternal(d *schema.ResourceData, meta interface{}) error
 			d.SetId("")
 			return nil
 		} else {
-			return fmt.Errorf("Error retrieving Port: %s, do NOT change port type", portId)
+			return fmt.Errorf("Error retrieving Port: %s", portId)
 		}
 	}
 
-	// Stop port if it is currently running
-	if "RUNNING" == port.Component.State {
-		err = client.StopPort(port)
+	// Remote accessibility can only be changed while the port is stopped
+	allowRemoteAccess := PortAllowRemoteAccessFromSchema(d)
+	remoteAccessChanged := nil != allowRemoteAccess &&
+		(nil == port.Component.AllowRemoteAccess || *allowRemoteAccess != *port.Component.AllowRemoteAccess)
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutUpdate))
+	defer cancel()
+
+	// Stop port if it is currently running, NiFi only moves stopped ports
+	parentGroupId := ComponentParentGroupIdFromSchema(d)
+	wasRunning := "RUNNING" == port.Component.State
+	if wasRunning {
+		err = client.StopPort(ctx, port)
 		if err != nil {
+			if parentGroupId != port.Component.ParentGroupId {
+				return fmt.Errorf("Failed to stop Port %s in order to move it: %s", portId, err)
+			}
+			if remoteAccessChanged {
+				return fmt.Errorf("Failed to stop Port %s in order to change remote access", portId)
+			}
 			log.Printf("[INFO] Failed to stop Port: %s ", port.Component.Id)
 		} else {
 			log.Printf("[INFO] Port now in state: %s ", port.Component.State)
 		}
 	}
-	log.Printf("[INFO] ******0")
+
+	// Move port to its new parent group
+	if parentGroupId != port.Component.ParentGroupId {
+		componentType := "inputPorts"
+		if "OUTPUT_PORT" == port.Component.PortType {
+			componentType = "outputPorts"
+		}
+		err = client.MoveComponent(componentType, portId, port.Revision, port.Component.ParentGroupId, parentGroupId)
+		if err != nil {
+			if wasRunning {
+				client.StartPort(ctx, port)
+			}
+			return fmt.Errorf("Failed to move Port %s to Process Group %s: %s", portId, parentGroupId, err)
+		}
+		d.Set("parent_group_id", parentGroupId)
+
+		port, err = client.GetPort(portId, port_type)
+		if err != nil {
+			return fmt.Errorf("Error retrieving Port: %s", portId)
+		}
+	}
 
 	err = PortFromSchema(d, port)
 	if err != nil {
 		return fmt.Errorf("Failed to parse Port schema: %s", portId)
 	}
-	log.Printf("[INFO] ******1")
 	err = client.UpdatePort(port)
 	if err != nil {
 		return fmt.Errorf("Failed to update Port: %s", err)
 	}
 
-	log.Printf("[INFO] ******2")
-	// Start processor again
-	err = client.StartPort(port)
-	if err != nil {
-		log.Printf("[INFO] Failed to start Port: %s", portId)
+	// Start port again if it was running before
+	if wasRunning {
+		err = client.StartPort(ctx, port)
+		if err != nil {
+			log.Printf("[INFO] Failed to start Port: %s", portId)
+		}
 	}
 	log.Printf("[INFO] Done update port %s", portId)
 	return ResourcePortRead(d, meta)
@@ -186,13 +261,8 @@ func ResourcePortDelete(d *schema.ResourceData, meta interface{}) error {
 
 func ResourcePortDeleteInternal(d *schema.ResourceData, meta interface{}) error {
 	portId := d.Id()
-	v := d.Get("component").([]interface{})
-	if len(v) != 1 {
-		return fmt.Errorf("Exactly one component is required")
-	}
-	component := v[0].(map[string]interface{})
-	port_type := component["type"].(string)
-	log.Printf("Deleteing port ********************************%s,%s, %s", port_type, portId)
+	port_type := PortTypeFromSchema(d)
+	log.Printf("[INFO] Deleting %s: %s", port_type, portId)
 	// Refresh processor details
 	client := meta.(*Client)
 	port, err := client.GetPort(portId, port_type)
@@ -204,10 +274,11 @@ func ResourcePortDeleteInternal(d *schema.ResourceData, meta interface{}) error
 			return fmt.Errorf("Error retrieving Port: %s", portId)
 		}
 	}
-	log.Printf("Deleteing port ********************************1")
 	// Stop processor if it is currently running
 	if "STOPPED" != port.Component.State {
-		err = client.StopPort(port)
+		ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutDelete))
+		defer cancel()
+		err = client.StopPort(ctx, port)
 		if err != nil {
 			return fmt.Errorf("[WARN] Failed to stop Port: %s", portId)
 		} else {
@@ -218,9 +289,7 @@ func ResourcePortDeleteInternal(d *schema.ResourceData, meta interface{}) error
 			}
 		}
 	}
-	//refresh version
-	// Delete processor
-	log.Printf("Deleteing port ********************************2")
+	// Delete port
 	err = client.DeletePort(port)
 	if err != nil {
 		return fmt.Errorf("Error deleting Port: %s", portId)
@@ -232,12 +301,7 @@ func ResourcePortDeleteInternal(d *schema.ResourceData, meta interface{}) error
 
 func ResourcePortExists(d *schema.ResourceData, meta interface{}) (bool, error) {
 	portId := d.Id()
-	v := d.Get("component").([]interface{})
-	if len(v) != 1 {
-		return false, fmt.Errorf("Exactly one component is required")
-	}
-	component := v[0].(map[string]interface{})
-	port_type := component["type"].(string)
+	port_type := PortTypeFromSchema(d)
 
 	client := meta.(*Client)
 	_, err := client.GetPort(portId, port_type)
@@ -267,6 +331,23 @@ func PortFromSchema(d *schema.ResourceData, port *Port) error {
 	port.Component.ParentGroupId = component["parent_group_id"].(string)
 	port.Component.Name = component["name"].(string)
 	port.Component.PortType = component["type"].(string)
+	port.Component.Comments, _ = component["comments"].(string)
+	port.Component.AllowRemoteAccess = PortAllowRemoteAccessFromSchema(d)
+	port.Component.ConcurrentlySchedulableTaskCount, _ = component["concurrently_schedulable_task_count"].(int)
+	port.Component.PortFunction, _ = component["port_function"].(string)
+
+	port.Component.UserAccessControl = []string{}
+	if v, ok := component["user_access_control"].(*schema.Set); ok {
+		for _, user := range v.List() {
+			port.Component.UserAccessControl = append(port.Component.UserAccessControl, user.(string))
+		}
+	}
+	port.Component.GroupAccessControl = []string{}
+	if v, ok := component["group_access_control"].(*schema.Set); ok {
+		for _, group := range v.List() {
+			port.Component.GroupAccessControl = append(port.Component.GroupAccessControl, group.(string))
+		}
+	}
 
 	v = component["position"].([]interface{})
 	if len(v) != 1 {
@@ -278,12 +359,39 @@ func PortFromSchema(d *schema.ResourceData, port *Port) error {
 	return nil
 }
 
+// Port type is not known upon import, ports are looked up by id alone in that case.
+func PortTypeFromSchema(d *schema.ResourceData) string {
+	v := d.Get("component").([]interface{})
+	if len(v) != 1 {
+		return ""
+	}
+	component := v[0].(map[string]interface{})
+	portType, _ := component["type"].(string)
+	return portType
+}
+
+// Remote access of new ports is left to NiFi unless it is enabled explicitly,
+// existing ports keep the value reported by NiFi unless it is set explicitly.
+func PortAllowRemoteAccessFromSchema(d *schema.ResourceData) *bool {
+	v, ok := d.GetOk("component.0.allow_remote_access")
+	if !ok && "" == d.Id() {
+		return nil
+	}
+	allowRemoteAccess, _ := v.(bool)
+	return &allowRemoteAccess
+}
+
 func PortToSchema(d *schema.ResourceData, port *Port) error {
 	revision := []map[string]interface{}{{
 		"version": port.Revision.Version,
 	}}
 	d.Set("revision", revision)
 
+	// Parent group id is not known upon import
+	if "" == d.Get("parent_group_id").(string) {
+		d.Set("parent_group_id", port.Component.ParentGroupId)
+	}
+
 	component := []map[string]interface{}{{
 		"parent_group_id": d.Get("parent_group_id").(string),
 		"name":            interface{}(port.Component.Name).(string),
@@ -292,7 +400,23 @@ func PortToSchema(d *schema.ResourceData, port *Port) error {
 			"x": port.Component.Position.X,
 			"y": port.Component.Position.Y,
 		}},
+		"comments":                            port.Component.Comments,
+		"concurrently_schedulable_task_count": port.Component.ConcurrentlySchedulableTaskCount,
+		"user_access_control":                 PortAccessControlToSchema(port.Component.UserAccessControl),
+		"group_access_control":                PortAccessControlToSchema(port.Component.GroupAccessControl),
+		"port_function":                       port.Component.PortFunction,
 	}}
+	if nil != port.Component.AllowRemoteAccess {
+		component[0]["allow_remote_access"] = *port.Component.AllowRemoteAccess
+	}
 	d.Set("component", component)
 	return nil
 }
+
+func PortAccessControlToSchema(identities []string) []interface{} {
+	result := []interface{}{}
+	for _, identity := range identities {
+		result = append(result, identity)
+	}
+	return result
+}
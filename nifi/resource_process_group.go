@@ -1,8 +1,10 @@
 package nifi
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/hashicorp/terraform/helper/schema"
 )
@@ -15,9 +17,41 @@ func ResourceProcessGroup() *schema.Resource {
 		Delete: ResourceProcessGroupDelete,
 		Exists: ResourceProcessGroupExists,
 
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(10 * time.Minute),
+			Update: schema.DefaultTimeout(10 * time.Minute),
+			Delete: schema.DefaultTimeout(10 * time.Minute),
+		},
+
 		Schema: map[string]*schema.Schema{
 			"parent_group_id": SchemaParentGroupId(),
 			"revision":        SchemaRevision(),
+			"force_delete": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			// Only the variables listed in the configuration are managed, others are left intact
+			"variables": {
+				Type:     schema.TypeMap,
+				Optional: true,
+			},
+			"running_count": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"stopped_count": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"invalid_count": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"disabled_count": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
 			"component": {
 				Type:     schema.TypeList,
 				Required: true,
@@ -32,6 +66,46 @@ func ResourceProcessGroup() *schema.Resource {
 							Required: true,
 						},
 						"position": SchemaPosition(),
+						"comments": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"flowfile_concurrency": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							Computed:     true,
+							ValidateFunc: ValidateStringInSlice([]string{"UNBOUNDED", "SINGLE_FLOWFILE_PER_NODE", "SINGLE_BATCH_PER_NODE"}),
+						},
+						"flowfile_outbound_policy": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							Computed:     true,
+							ValidateFunc: ValidateStringInSlice([]string{"STREAM_WHEN_AVAILABLE", "BATCH_OUTPUT"}),
+						},
+						"default_flowfile_expiration": {
+							Type:     schema.TypeString,
+							Optional: true,
+							Computed: true,
+						},
+						"default_back_pressure_object_threshold": {
+							Type:     schema.TypeInt,
+							Optional: true,
+							Computed: true,
+						},
+						"default_back_pressure_data_size_threshold": {
+							Type:     schema.TypeString,
+							Optional: true,
+							Computed: true,
+						},
+						"log_file_suffix": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"run_status": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							ValidateFunc: ValidateStringInSlice([]string{"RUNNING", "STOPPED"}),
+						},
 					},
 				},
 			},
@@ -58,6 +132,23 @@ func ResourceProcessGroupCreate(d *schema.ResourceData, meta interface{}) error
 	d.SetId(processGroup.Component.Id)
 	d.Set("parent_group_id", parentGroupId)
 
+	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutCreate))
+	defer cancel()
+
+	// Variable updates restart referencing processors, hence those are serialized with other updates
+	client.Lock.Lock()
+	err = ProcessGroupUpdateVariables(ctx, client, d)
+	client.Lock.Unlock()
+	if err != nil {
+		return fmt.Errorf("Failed to update variables of Process Group %s: %s", processGroup.Component.Id, err)
+	}
+
+	runStatus := ProcessGroupRunStatusFromSchema(d)
+	err = ProcessGroupApplyRunStatus(ctx, client, processGroup.Component.Id, runStatus)
+	if err != nil {
+		return fmt.Errorf("Failed to set Process Group %s run status to %s: %s", processGroup.Component.Id, runStatus, err)
+	}
+
 	return ResourceProcessGroupRead(d, meta)
 }
 
@@ -75,10 +166,34 @@ func ResourceProcessGroupRead(d *schema.ResourceData, meta interface{}) error {
 		return fmt.Errorf("Failed to serialize Process Group: %s", processGroupId)
 	}
 
+	// Variable registry is not available in NiFi versions with parameter contexts only
+	variables, _, err := client.GetProcessGroupVariables(processGroupId)
+	if nil == err {
+		managed := map[string]interface{}{}
+		for name := range d.Get("variables").(map[string]interface{}) {
+			if value, ok := variables[name]; ok {
+				managed[name] = value
+			}
+		}
+		d.Set("variables", managed)
+	} else if "not_found" != err.Error() {
+		return fmt.Errorf("Error retrieving variables of Process Group: %s", processGroupId)
+	}
+
 	return nil
 }
 
 func ResourceProcessGroupUpdate(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Client)
+	client.Lock.Lock()
+	log.Printf("[INFO] Updating Process Group: %s...", d.Id())
+	err := ResourceProcessGroupUpdateInternal(d, meta)
+	log.Printf("[INFO] Process Group updated: %s", d.Id())
+	defer client.Lock.Unlock()
+	return err
+}
+
+func ResourceProcessGroupUpdateInternal(d *schema.ResourceData, meta interface{}) error {
 	processGroupId := d.Id()
 
 	client := meta.(*Client)
@@ -92,6 +207,24 @@ func ResourceProcessGroupUpdate(d *schema.ResourceData, meta interface{}) error
 		}
 	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutUpdate))
+	defer cancel()
+
+	// Move process group to its new parent group
+	parentGroupId := ComponentParentGroupIdFromSchema(d)
+	if parentGroupId != processGroup.Component.ParentGroupId {
+		err = ProcessGroupMove(ctx, client, processGroup, parentGroupId)
+		if err != nil {
+			return fmt.Errorf("Failed to move Process Group %s to Process Group %s: %s", processGroupId, parentGroupId, err)
+		}
+		d.Set("parent_group_id", parentGroupId)
+
+		processGroup, err = client.GetProcessGroup(processGroupId)
+		if err != nil {
+			return fmt.Errorf("Error retrieving Process Group: %s", processGroupId)
+		}
+	}
+
 	err = ProcessGroupFromSchema(d, processGroup)
 	if err != nil {
 		return fmt.Errorf("Failed to parse Process Group schema: %s", processGroupId)
@@ -102,12 +235,38 @@ func ResourceProcessGroupUpdate(d *schema.ResourceData, meta interface{}) error
 		return fmt.Errorf("Failed to update Process Group: %s", processGroupId)
 	}
 
+	// Variable updates restart referencing processors, hence those are serialized with other updates
+	if d.HasChange("variables") {
+		err = ProcessGroupUpdateVariables(ctx, client, d)
+		if err != nil {
+			return fmt.Errorf("Failed to update variables of Process Group %s: %s", processGroupId, err)
+		}
+	}
+
+	// Components keep their own run status unless the group's run status is changed
+	if d.HasChange("component.0.run_status") {
+		runStatus := ProcessGroupRunStatusFromSchema(d)
+		err = ProcessGroupApplyRunStatus(ctx, client, processGroupId, runStatus)
+		if err != nil {
+			return fmt.Errorf("Failed to set Process Group %s run status to %s: %s", processGroupId, runStatus, err)
+		}
+	}
+
 	return ResourceProcessGroupRead(d, meta)
 }
 
 func ResourceProcessGroupDelete(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Client)
+	client.Lock.Lock()
+	log.Printf("[INFO] Deleting Process Group: %s", d.Id())
+	err := ResourceProcessGroupDeleteInternal(d, meta)
+	log.Printf("[INFO] Process Group deleted: %s", d.Id())
+	defer client.Lock.Unlock()
+	return err
+}
+
+func ResourceProcessGroupDeleteInternal(d *schema.ResourceData, meta interface{}) error {
 	processGroupId := d.Id()
-	log.Printf("[INFO] Deleting Process Group: %s", processGroupId)
 
 	client := meta.(*Client)
 	processGroup, err := client.GetProcessGroup(processGroupId)
@@ -120,6 +279,21 @@ func ResourceProcessGroupDelete(d *schema.ResourceData, meta interface{}) error
 		}
 	}
 
+	// NiFi refuses to delete groups with running components, enabled services or queued data
+	if d.Get("force_delete").(bool) {
+		ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutDelete))
+		defer cancel()
+		err = ProcessGroupPurge(ctx, client, processGroupId)
+		if err != nil {
+			return fmt.Errorf("Failed to purge Process Group %s: %s", processGroupId, err)
+		}
+
+		processGroup, err = client.GetProcessGroup(processGroupId)
+		if err != nil {
+			return fmt.Errorf("Error retrieving Process Group: %s", processGroupId)
+		}
+	}
+
 	err = client.DeleteProcessGroup(processGroup)
 	if err != nil {
 		return fmt.Errorf("Error deleting Process Group: %s", processGroupId)
@@ -159,6 +333,17 @@ func ProcessGroupFromSchema(d *schema.ResourceData, processGroup *ProcessGroup)
 	parentGroupId := component["parent_group_id"].(string)
 	processGroup.Component.ParentGroupId = parentGroupId
 	processGroup.Component.Name = component["name"].(string)
+	processGroup.Component.Comments, _ = component["comments"].(string)
+	processGroup.Component.FlowFileConcurrency = ProcessGroupSettingFromSchema(d, component, "flowfile_concurrency")
+	processGroup.Component.FlowFileOutboundPolicy = ProcessGroupSettingFromSchema(d, component, "flowfile_outbound_policy")
+	processGroup.Component.DefaultFlowFileExpiration = ProcessGroupSettingFromSchema(d, component, "default_flowfile_expiration")
+	processGroup.Component.DefaultBackPressureDataSizeThreshold = ProcessGroupSettingFromSchema(d, component, "default_back_pressure_data_size_threshold")
+	processGroup.Component.LogFileSuffix = ProcessGroupSettingFromSchema(d, component, "log_file_suffix")
+	processGroup.Component.DefaultBackPressureObjectThreshold = nil
+	threshold, _ := component["default_back_pressure_object_threshold"].(int)
+	if 0 != threshold || d.HasChange("component.0.default_back_pressure_object_threshold") {
+		processGroup.Component.DefaultBackPressureObjectThreshold = &threshold
+	}
 
 	v = component["position"].([]interface{})
 	if len(v) != 1 {
@@ -171,12 +356,51 @@ func ProcessGroupFromSchema(d *schema.ResourceData, processGroup *ProcessGroup)
 	return nil
 }
 
+// Settings are sent when specified or when they are removed, so that NiFi clears them.
+func ProcessGroupSettingFromSchema(d *schema.ResourceData, component map[string]interface{}, key string) *string {
+	value, _ := component[key].(string)
+	if "" == value && !d.HasChange("component.0."+key) {
+		return nil
+	}
+	return &value
+}
+
+func ProcessGroupRunStatusFromSchema(d *schema.ResourceData) string {
+	v := d.Get("component").([]interface{})
+	if len(v) != 1 {
+		return ""
+	}
+	component := v[0].(map[string]interface{})
+	runStatus, _ := component["run_status"].(string)
+	return runStatus
+}
+
 func ProcessGroupToSchema(d *schema.ResourceData, processGroup *ProcessGroup) error {
 	revision := []map[string]interface{}{{
 		"version": processGroup.Revision.Version,
 	}}
 	d.Set("revision", revision)
 
+	d.Set("running_count", processGroup.RunningCount)
+	d.Set("stopped_count", processGroup.StoppedCount)
+	d.Set("invalid_count", processGroup.InvalidCount)
+	d.Set("disabled_count", processGroup.DisabledCount)
+
+	// Run status is not tracked by NiFi for process groups, it is derived from the component counts.
+	// Groups are reported as stopped only if nothing is running, so that individually stopped
+	// processors of a running group don't cause perpetual differences.
+	runStatus := ProcessGroupRunStatusFromSchema(d)
+	if "RUNNING" == runStatus && 0 == processGroup.RunningCount && processGroup.StoppedCount > 0 {
+		runStatus = "STOPPED"
+	} else if "STOPPED" == runStatus && processGroup.RunningCount > 0 {
+		runStatus = "RUNNING"
+	}
+
+	defaultBackPressureObjectThreshold := 0
+	if nil != processGroup.Component.DefaultBackPressureObjectThreshold {
+		defaultBackPressureObjectThreshold = *processGroup.Component.DefaultBackPressureObjectThreshold
+	}
+
 	component := []map[string]interface{}{{
 		"parent_group_id": d.Get("parent_group_id").(string),
 		"name":            processGroup.Component.Name,
@@ -184,8 +408,523 @@ func ProcessGroupToSchema(d *schema.ResourceData, processGroup *ProcessGroup) er
 			"x": processGroup.Component.Position.X,
 			"y": processGroup.Component.Position.Y,
 		}},
+		"comments":                                  processGroup.Component.Comments,
+		"flowfile_concurrency":                      ProcessGroupSettingToSchema(processGroup.Component.FlowFileConcurrency),
+		"flowfile_outbound_policy":                  ProcessGroupSettingToSchema(processGroup.Component.FlowFileOutboundPolicy),
+		"default_flowfile_expiration":               ProcessGroupSettingToSchema(processGroup.Component.DefaultFlowFileExpiration),
+		"default_back_pressure_object_threshold":    defaultBackPressureObjectThreshold,
+		"default_back_pressure_data_size_threshold": ProcessGroupSettingToSchema(processGroup.Component.DefaultBackPressureDataSizeThreshold),
+		"log_file_suffix":                           ProcessGroupSettingToSchema(processGroup.Component.LogFileSuffix),
+		"run_status":                                runStatus,
 	}}
 	d.Set("component", component)
 
 	return nil
 }
+
+func ProcessGroupSettingToSchema(value *string) string {
+	if nil == value {
+		return ""
+	}
+	return *value
+}
+
+// Variable Helpers
+
+// Brings process group variables in line with the schema. Variables removed from the schema are deleted,
+// variables that were never listed in the schema are left intact.
+func ProcessGroupUpdateVariables(ctx context.Context, client *Client, d *schema.ResourceData) error {
+	processGroupId := d.Id()
+	o, n := d.GetChange("variables")
+	previous, _ := o.(map[string]interface{})
+	desired, _ := n.(map[string]interface{})
+
+	current, revision, err := client.GetProcessGroupVariables(processGroupId)
+	if nil != err {
+		if "not_found" == err.Error() && 0 == len(desired) {
+			return nil
+		}
+		return err
+	}
+
+	variables := map[string]*string{}
+	for name, v := range desired {
+		value := v.(string)
+		if currentValue, ok := current[name]; !ok || currentValue != value {
+			variables[name] = &value
+		}
+	}
+	for name := range previous {
+		if _, ok := desired[name]; ok {
+			continue
+		}
+		if _, ok := current[name]; ok {
+			variables[name] = nil
+		}
+	}
+	if 0 == len(variables) {
+		return nil
+	}
+
+	log.Printf("[INFO] Updating %d variables of Process Group: %s", len(variables), processGroupId)
+	return client.UpdateProcessGroupVariables(ctx, processGroupId, *revision, variables)
+}
+
+// Run Status Helpers
+
+// Starts or stops all components of the process group and its descendants. Controller services are enabled
+// before components are started and disabled after those are stopped, except for the services managed
+// as ENABLED by their own resources. Empty run status is a no-op.
+func ProcessGroupApplyRunStatus(ctx context.Context, client *Client, processGroupId string, runStatus string) error {
+	switch runStatus {
+	case "RUNNING":
+		log.Printf("[INFO] Enabling controller services of Process Group: %s", processGroupId)
+		err := client.SetProcessGroupControllerServicesState(processGroupId, "ENABLED", nil)
+		if nil != err {
+			return err
+		}
+		err = ProcessGroupWaitForControllerServices(ctx, client, processGroupId, "ENABLED", nil)
+		if nil != err {
+			return err
+		}
+
+		components, kept, err := ProcessGroupScheduledComponents(client, processGroupId)
+		if nil != err {
+			return err
+		}
+		log.Printf("[INFO] Starting components of Process Group: %s", processGroupId)
+		err = client.SetProcessGroupState(processGroupId, "RUNNING", components)
+		if nil != err {
+			return err
+		}
+		return ProcessGroupWaitForRunning(ctx, client, processGroupId, kept)
+	case "STOPPED":
+		log.Printf("[INFO] Stopping components of Process Group: %s", processGroupId)
+		err := client.SetProcessGroupState(processGroupId, "STOPPED", nil)
+		if nil != err {
+			return err
+		}
+		err = ProcessGroupWaitForStopped(ctx, client, processGroupId)
+		if nil != err {
+			return err
+		}
+		return ProcessGroupDisableControllerServices(ctx, client, processGroupId, true)
+	}
+	return nil
+}
+
+// Disables controller services of the process group and its descendants. When keepManaged is set, services
+// managed as ENABLED by their own resources are left enabled along with the services those depend on.
+func ProcessGroupDisableControllerServices(ctx context.Context, client *Client, processGroupId string, keepManaged bool) error {
+	log.Printf("[INFO] Disabling controller services of Process Group: %s", processGroupId)
+	if !keepManaged {
+		err := client.SetProcessGroupControllerServicesState(processGroupId, "DISABLED", nil)
+		if nil != err {
+			return err
+		}
+		return ProcessGroupWaitForControllerServices(ctx, client, processGroupId, "DISABLED", nil)
+	}
+
+	controllerServices, err := client.GetProcessGroupControllerServices(processGroupId)
+	if nil != err {
+		return err
+	}
+	kept := ProcessGroupManagedControllerServices(client, controllerServices)
+	components := map[string]Revision{}
+	for _, controllerService := range controllerServices {
+		if !kept[controllerService.Component.Id] && "DISABLED" != controllerService.Component.State {
+			components[controllerService.Component.Id] = controllerService.Revision
+		}
+	}
+	if 0 == len(components) {
+		return nil
+	}
+	err = client.SetProcessGroupControllerServicesState(processGroupId, "DISABLED", components)
+	if nil != err {
+		return err
+	}
+	return ProcessGroupWaitForControllerServices(ctx, client, processGroupId, "DISABLED", kept)
+}
+
+// Returns the services desired to be ENABLED by their own resources and, transitively, the services they reference.
+func ProcessGroupManagedControllerServices(client *Client, controllerServices []ControllerService) map[string]bool {
+	byId := map[string]*ControllerService{}
+	for i := range controllerServices {
+		byId[controllerServices[i].Component.Id] = &controllerServices[i]
+	}
+	managed := map[string]bool{}
+	var keep func(controllerService *ControllerService)
+	keep = func(controllerService *ControllerService) {
+		if managed[controllerService.Component.Id] {
+			return
+		}
+		managed[controllerService.Component.Id] = true
+		for _, v := range controllerService.Component.Properties {
+			if reference, ok := v.(string); ok && nil != byId[reference] {
+				keep(byId[reference])
+			}
+		}
+	}
+	for _, controllerService := range byId {
+		if state, ok := client.GetDesiredRunStatus(controllerService.Component.Id); ok && "ENABLED" == state {
+			keep(controllerService)
+		}
+	}
+	return managed
+}
+
+// Returns processors and ports of the process group and its descendants to be started along with the group,
+// processors managed as STOPPED, DISABLED or RUN_ONCE by their own resources are left out. Components are nil
+// when nothing is left out, so that NiFi schedules everything. The number of processors left out is returned as well.
+func ProcessGroupScheduledComponents(client *Client, processGroupId string) (map[string]Revision, int, error) {
+	components := map[string]Revision{}
+	kept, err := ProcessGroupCollectScheduledComponents(client, processGroupId, components)
+	if nil != err || 0 == kept {
+		return nil, 0, err
+	}
+	return components, kept, nil
+}
+
+func ProcessGroupCollectScheduledComponents(client *Client, processGroupId string, components map[string]Revision) (int, error) {
+	kept := 0
+	processors, err := client.GetProcessGroupProcessors(processGroupId)
+	if nil != err {
+		return 0, err
+	}
+	for _, processor := range processors {
+		if runStatus, ok := client.GetDesiredRunStatus(processor.Component.Id); ok && "RUNNING" != runStatus {
+			kept++
+			continue
+		}
+		components[processor.Component.Id] = processor.Revision
+	}
+	ports, err := client.GetProcessGroupPorts(processGroupId)
+	if nil != err {
+		return 0, err
+	}
+	for _, port := range ports {
+		components[port.Component.Id] = port.Revision
+	}
+
+	childGroups, err := client.GetProcessGroupChildGroups(processGroupId)
+	if nil != err {
+		return 0, err
+	}
+	for _, childGroup := range childGroups {
+		childKept, err := ProcessGroupCollectScheduledComponents(client, childGroup.Component.Id, components)
+		if nil != err {
+			return 0, err
+		}
+		kept += childKept
+	}
+	return kept, nil
+}
+
+// Invalid and disabled components are never started by NiFi, those are not counted as stopped.
+// Kept is the number of processors that are supposed to stay stopped.
+func ProcessGroupWaitForRunning(ctx context.Context, client *Client, processGroupId string, kept int) error {
+	return client.WaitForAsyncRequest(ctx, AsyncRequest{
+		Name: fmt.Sprintf("Process Group %s components to start", processGroupId),
+		Poll: func() (AsyncRequestStatus, error) {
+			processGroup, err := client.GetProcessGroup(processGroupId)
+			if nil != err {
+				return AsyncRequestStatus{}, err
+			}
+			return AsyncRequestStatus{
+				Finished: processGroup.StoppedCount <= kept,
+				State: fmt.Sprintf("%d running, %d stopped, %d invalid",
+					processGroup.RunningCount, processGroup.StoppedCount, processGroup.InvalidCount),
+			}, nil
+		},
+	})
+}
+
+// Move Helpers
+
+// Moves the process group into another process group. NiFi only moves stopped groups, components running
+// before the move are stopped meanwhile and started again afterwards.
+func ProcessGroupMove(ctx context.Context, client *Client, processGroup *ProcessGroup, parentGroupId string) error {
+	processGroupId := processGroup.Component.Id
+	running := map[string]bool{}
+	err := ProcessGroupCollectRunningComponents(client, processGroupId, running)
+	if nil != err {
+		return err
+	}
+
+	if len(running) > 0 {
+		log.Printf("[INFO] Stopping %d components of Process Group %s before the move", len(running), processGroupId)
+		err = client.SetProcessGroupState(processGroupId, "STOPPED", nil)
+		if nil == err {
+			err = ProcessGroupWaitForStopped(ctx, client, processGroupId)
+		}
+		if nil == err {
+			// Stopping components increments the group's revision
+			processGroup, err = client.GetProcessGroup(processGroupId)
+		}
+		if nil != err {
+			ProcessGroupStartComponents(client, processGroupId, running)
+			return err
+		}
+	}
+
+	err = client.MoveComponent("processGroups", processGroupId, processGroup.Revision, processGroup.Component.ParentGroupId, parentGroupId)
+	startErr := ProcessGroupStartComponents(client, processGroupId, running)
+	if nil != err {
+		return err
+	}
+	if nil != startErr {
+		return fmt.Errorf("Failed to start components of Process Group %s again: %s", processGroupId, startErr)
+	}
+	return nil
+}
+
+// Collects ids of running processors and ports of the process group and its descendants.
+func ProcessGroupCollectRunningComponents(client *Client, processGroupId string, running map[string]bool) error {
+	processors, err := client.GetProcessGroupProcessors(processGroupId)
+	if nil != err {
+		return err
+	}
+	for _, processor := range processors {
+		if "RUNNING" == processor.Component.State {
+			running[processor.Component.Id] = true
+		}
+	}
+	ports, err := client.GetProcessGroupPorts(processGroupId)
+	if nil != err {
+		return err
+	}
+	for _, port := range ports {
+		if "RUNNING" == port.Component.State {
+			running[port.Component.Id] = true
+		}
+	}
+
+	childGroups, err := client.GetProcessGroupChildGroups(processGroupId)
+	if nil != err {
+		return err
+	}
+	for _, childGroup := range childGroups {
+		err = ProcessGroupCollectRunningComponents(client, childGroup.Component.Id, running)
+		if nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+// Starts the given processors and ports of the process group and its descendants.
+func ProcessGroupStartComponents(client *Client, processGroupId string, ids map[string]bool) error {
+	if 0 == len(ids) {
+		return nil
+	}
+	components := map[string]Revision{}
+	err := ProcessGroupCollectComponentRevisions(client, processGroupId, ids, components)
+	if nil != err || 0 == len(components) {
+		return err
+	}
+	return client.SetProcessGroupState(processGroupId, "RUNNING", components)
+}
+
+func ProcessGroupCollectComponentRevisions(client *Client, processGroupId string, ids map[string]bool, components map[string]Revision) error {
+	processors, err := client.GetProcessGroupProcessors(processGroupId)
+	if nil != err {
+		return err
+	}
+	for _, processor := range processors {
+		if ids[processor.Component.Id] {
+			components[processor.Component.Id] = processor.Revision
+		}
+	}
+	ports, err := client.GetProcessGroupPorts(processGroupId)
+	if nil != err {
+		return err
+	}
+	for _, port := range ports {
+		if ids[port.Component.Id] {
+			components[port.Component.Id] = port.Revision
+		}
+	}
+
+	childGroups, err := client.GetProcessGroupChildGroups(processGroupId)
+	if nil != err {
+		return err
+	}
+	for _, childGroup := range childGroups {
+		err = ProcessGroupCollectComponentRevisions(client, childGroup.Component.Id, ids, components)
+		if nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+// Purge Helpers
+
+// Stops all components, disables all controller services and empties all queues of the process group
+// and its descendants, so that NiFi accepts the group removal. Connections of the parent group leading to
+// or from the group's ports are emptied and removed as well, NiFi refuses to delete connected groups.
+func ProcessGroupPurge(ctx context.Context, client *Client, processGroupId string) error {
+	err := ProcessGroupPurgePortConnections(ctx, client, processGroupId)
+	if nil != err {
+		return err
+	}
+
+	log.Printf("[INFO] Stopping components of Process Group: %s", processGroupId)
+	err = client.SetProcessGroupState(processGroupId, "STOPPED", nil)
+	if nil != err {
+		return err
+	}
+	err = ProcessGroupWaitForStopped(ctx, client, processGroupId)
+	if nil != err {
+		return err
+	}
+	// Services are removed along with the group, regardless of their own resources
+	err = ProcessGroupDisableControllerServices(ctx, client, processGroupId, false)
+	if nil != err {
+		return err
+	}
+
+	connections, err := ProcessGroupConnectionsRecursive(client, processGroupId)
+	if nil != err {
+		return err
+	}
+	log.Printf("[INFO] Emptying %d connections of Process Group: %s", len(connections), processGroupId)
+	for i := range connections {
+		log.Printf("[INFO] Dropping data of Connection %s (%d of %d)", connections[i].Component.Id, i+1, len(connections))
+		err = client.DropConnectionData(ctx, &connections[i])
+		if nil != err {
+			return err
+		}
+	}
+
+	log.Printf("[INFO] Process Group purged: %s", processGroupId)
+	return nil
+}
+
+// Empties and removes connections of the parent group that feed the group's input ports or read from its
+// output ports. Components on the other end are stopped meanwhile and started again if they were running.
+func ProcessGroupPurgePortConnections(ctx context.Context, client *Client, processGroupId string) error {
+	processGroup, err := client.GetProcessGroup(processGroupId)
+	if nil != err {
+		return err
+	}
+	connections, err := client.GetProcessGroupConnections(processGroup.Component.ParentGroupId)
+	if nil != err {
+		return err
+	}
+
+	for i := range connections.Connections {
+		connection := &connections.Connections[i]
+		connectionId := connection.Component.Id
+		hands := []*ConnectionHand{}
+		if processGroupId == connection.Component.Destination.GroupId {
+			hands = append(hands, &connection.Component.Source)
+		}
+		if processGroupId == connection.Component.Source.GroupId {
+			hands = append(hands, &connection.Component.Destination)
+		}
+		if 0 == len(hands) {
+			continue
+		}
+		log.Printf("[WARN] Removing Connection %s attached to ports of Process Group %s", connectionId, processGroupId)
+
+		// Ports of the group itself are stopped along with the group
+		stopped := []ConnectionHand{}
+		for _, hand := range hands {
+			if processGroupId == hand.GroupId {
+				continue
+			}
+			running, err := client.StopConnectionHand(ctx, hand)
+			if nil != err {
+				ConnectionStartHands(ctx, client, stopped)
+				return err
+			}
+			if running {
+				stopped = append(stopped, *hand)
+			}
+		}
+
+		err = client.DropConnectionData(ctx, connection)
+		if nil == err {
+			connection, err = client.GetConnection(connectionId)
+		}
+		if nil == err {
+			err = client.DeleteConnection(connection)
+		}
+		ConnectionStartHands(ctx, client, stopped)
+		if nil != err {
+			return fmt.Errorf("Failed to remove Connection %s: %s", connectionId, err)
+		}
+	}
+	return nil
+}
+
+func ProcessGroupWaitForStopped(ctx context.Context, client *Client, processGroupId string) error {
+	return client.WaitForAsyncRequest(ctx, AsyncRequest{
+		Name: fmt.Sprintf("Process Group %s components to stop", processGroupId),
+		Poll: func() (AsyncRequestStatus, error) {
+			processGroup, err := client.GetProcessGroup(processGroupId)
+			if nil != err {
+				return AsyncRequestStatus{}, err
+			}
+			activeThreadCount := 0
+			if nil != processGroup.Status {
+				activeThreadCount = processGroup.Status.AggregateSnapshot.ActiveThreadCount
+			}
+			return AsyncRequestStatus{
+				Finished: 0 == processGroup.RunningCount && 0 == activeThreadCount,
+				State:    fmt.Sprintf("%d running, %d active threads", processGroup.RunningCount, activeThreadCount),
+			}, nil
+		},
+	})
+}
+
+func ProcessGroupWaitForControllerServices(ctx context.Context, client *Client, processGroupId string, state string, skipped map[string]bool) error {
+	return client.WaitForAsyncRequest(ctx, AsyncRequest{
+		Name: fmt.Sprintf("Process Group %s controller services to become %s", processGroupId, state),
+		Poll: func() (AsyncRequestStatus, error) {
+			controllerServices, err := client.GetProcessGroupControllerServices(processGroupId)
+			if nil != err {
+				return AsyncRequestStatus{}, err
+			}
+			remaining := 0
+			for _, controllerService := range controllerServices {
+				// Invalid services are never enabled by NiFi
+				if "ENABLED" == state && ControllerServiceIsInvalid(&controllerService) {
+					continue
+				}
+				if skipped[controllerService.Component.Id] {
+					continue
+				}
+				if state != controllerService.Component.State {
+					remaining++
+				}
+			}
+			return AsyncRequestStatus{
+				Finished: 0 == remaining,
+				State:    fmt.Sprintf("%d remaining", remaining),
+			}, nil
+		},
+	})
+}
+
+func ProcessGroupConnectionsRecursive(client *Client, processGroupId string) ([]Connection, error) {
+	connections, err := client.GetProcessGroupConnections(processGroupId)
+	if nil != err {
+		return nil, err
+	}
+	result := connections.Connections
+
+	childGroups, err := client.GetProcessGroupChildGroups(processGroupId)
+	if nil != err {
+		return nil, err
+	}
+	for _, childGroup := range childGroups {
+		childConnections, err := ProcessGroupConnectionsRecursive(client, childGroup.Component.Id)
+		if nil != err {
+			return nil, err
+		}
+		result = append(result, childConnections...)
+	}
+	return result, nil
+}
@@ -1,8 +1,11 @@
 package nifi
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/terraform/helper/schema"
 )
@@ -18,6 +21,24 @@ func ResourceProcessor() *schema.Resource {
 		Schema: map[string]*schema.Schema{
 			"parent_group_id": SchemaParentGroupId(),
 			"revision":        SchemaRevision(),
+			"validation_status": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"validation_errors": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"fail_on_invalid": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"clear_state_on_change": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
 			"component": {
 				Type:     schema.TypeList,
 				Required: true,
@@ -36,6 +57,12 @@ func ResourceProcessor() *schema.Resource {
 							Required: true,
 						},
 						"position": SchemaPosition(),
+						"run_status": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							Default:      "RUNNING",
+							ValidateFunc: ValidateStringInSlice([]string{"RUNNING", "STOPPED", "DISABLED", "RUN_ONCE"}),
+						},
 						"config": {
 							Type:     schema.TypeList,
 							Required: true,
@@ -61,6 +88,61 @@ func ResourceProcessor() *schema.Resource {
 										Optional: true,
 										Default:  "ALL",
 									},
+									"penalty_duration": {
+										Type:     schema.TypeString,
+										Optional: true,
+										Default:  "30 sec",
+									},
+									"yield_duration": {
+										Type:     schema.TypeString,
+										Optional: true,
+										Default:  "1 sec",
+									},
+									"bulletin_level": {
+										Type:         schema.TypeString,
+										Optional:     true,
+										Default:      "WARN",
+										ValidateFunc: ValidateStringInSlice([]string{"DEBUG", "INFO", "WARN", "ERROR"}),
+									},
+									"run_duration_millis": {
+										Type:     schema.TypeInt,
+										Optional: true,
+										Default:  0,
+									},
+									"comments": {
+										Type:     schema.TypeString,
+										Optional: true,
+									},
+									"annotation_data": {
+										Type:     schema.TypeString,
+										Optional: true,
+									},
+									"loss_tolerant": {
+										Type:     schema.TypeBool,
+										Optional: true,
+										Default:  false,
+									},
+									"retried_relationships": {
+										Type:     schema.TypeList,
+										Optional: true,
+										Elem:     &schema.Schema{Type: schema.TypeString},
+									},
+									"retry_count": {
+										Type:     schema.TypeInt,
+										Optional: true,
+										Computed: true,
+									},
+									"backoff_mechanism": {
+										Type:         schema.TypeString,
+										Optional:     true,
+										Computed:     true,
+										ValidateFunc: ValidateStringInSlice([]string{"PENALIZE_FLOWFILE", "YIELD_PROCESSOR"}),
+									},
+									"max_backoff_period": {
+										Type:     schema.TypeString,
+										Optional: true,
+										Computed: true,
+									},
 									"properties": {
 										Type:     schema.TypeMap,
 										Required: true,
@@ -97,16 +179,27 @@ func ResourceProcessorCreate(d *schema.ResourceData, meta interface{}) error {
 		return fmt.Errorf("Failed to create Processor")
 	}
 
-	// Start processor upon creation
-	err = client.StartProcessor(processor)
-	if nil != err {
-		log.Printf("[INFO] Failed to start Processor: %s ", processor.Component.Id)
-	}
-
 	// Indicate successful creation
 	d.SetId(processor.Component.Id)
 	d.Set("parent_group_id", parentGroupId)
 
+	// Bring processor to its desired run status upon creation
+	runStatus := ProcessorRunStatusFromSchema(d)
+	client.SetDesiredRunStatus(processor.Component.Id, runStatus)
+	err = ProcessorApplyRunStatus(client, processor, runStatus)
+	if nil != err {
+		ResourceProcessorRead(d, meta)
+		return fmt.Errorf("Failed to set Processor %s run status to %s: %s", processor.Component.Id, runStatus, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutCreate))
+	defer cancel()
+	err = ProcessorCheckValidation(ctx, client, d, runStatus)
+	if nil != err {
+		ResourceProcessorRead(d, meta)
+		return err
+	}
+
 	return ResourceProcessorRead(d, meta)
 }
 
@@ -119,6 +212,10 @@ func ResourceProcessorRead(d *schema.ResourceData, meta interface{}) error {
 		return fmt.Errorf("Error retrieving Processor: %s", processorId)
 	}
 
+	if runStatus := ProcessorRunStatusFromSchema(d); "" != runStatus {
+		client.SetDesiredRunStatus(processorId, runStatus)
+	}
+
 	err = ProcessorToSchema(d, processor)
 	if err != nil {
 		return fmt.Errorf("Failed to serialize Processor: %s", processorId)
@@ -152,14 +249,36 @@ func ResourceProcessorUpdateInternal(d *schema.ResourceData, meta interface{}) e
 		}
 	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutUpdate))
+	defer cancel()
+
 	// Stop processor if it is currently running
-	if "RUNNING" == processor.Component.State {
+	wasRunning := "RUNNING" == processor.Component.State
+	if wasRunning {
 		err = client.StopProcessor(processor)
 		if err != nil {
 			return fmt.Errorf("Failed to stop Processor: %s", processorId)
 		}
 	}
 
+	// Move processor to its new parent group
+	parentGroupId := ComponentParentGroupIdFromSchema(d)
+	if parentGroupId != processor.Component.ParentGroupId {
+		err = client.MoveComponent("processors", processorId, processor.Revision, processor.Component.ParentGroupId, parentGroupId)
+		if err != nil {
+			if wasRunning {
+				client.StartProcessor(processor)
+			}
+			return fmt.Errorf("Failed to move Processor %s to Process Group %s: %s", processorId, parentGroupId, err)
+		}
+		d.Set("parent_group_id", parentGroupId)
+
+		processor, err = client.GetProcessor(processorId)
+		if err != nil {
+			return fmt.Errorf("Error retrieving Processor: %s", processorId)
+		}
+	}
+
 	// Load processor's desired state
 	err = ProcessorFromSchema(d, processor)
 	if err != nil {
@@ -168,7 +287,7 @@ func ResourceProcessorUpdateInternal(d *schema.ResourceData, meta interface{}) e
 
 	// Compare new list of auto-terminated connections against the list of processor's existing connections.
 	// It is not possible to auto-terminate a relationship if an existing connection declares this relationship type.
-	err = ProcessorRemoveOverlappingConnections(client, processor)
+	err = ProcessorRemoveOverlappingConnections(ctx, client, processor)
 	if nil != err {
 		return fmt.Errorf("Failed to cleanup connections for Processor: %s", processorId)
 	}
@@ -179,10 +298,30 @@ func ResourceProcessorUpdateInternal(d *schema.ResourceData, meta interface{}) e
 		return fmt.Errorf("Failed to update Processor: %s", processorId)
 	}
 
-	// Start processor again
-	err = client.StartProcessor(processor)
-	if err != nil {
-		log.Printf("[INFO] Failed to start Processor: %s", processorId)
+	// Reset processor's component state while it is stopped
+	if d.HasChange("clear_state_on_change") {
+		err = client.ClearProcessorState(processor)
+		if err != nil {
+			return fmt.Errorf("Failed to clear state of Processor: %s", processorId)
+		}
+		log.Printf("[INFO] Processor state cleared: %s", processorId)
+	}
+
+	// Bring processor back to its desired run status, RUN_ONCE is only triggered when run status changes
+	runStatus := ProcessorRunStatusFromSchema(d)
+	client.SetDesiredRunStatus(processorId, runStatus)
+	if "RUN_ONCE" != runStatus || d.HasChange("component.0.run_status") {
+		err = ProcessorApplyRunStatus(client, processor, runStatus)
+		if err != nil {
+			ResourceProcessorRead(d, meta)
+			return fmt.Errorf("Failed to set Processor %s run status to %s: %s", processorId, runStatus, err)
+		}
+	}
+
+	err = ProcessorCheckValidation(ctx, client, d, runStatus)
+	if nil != err {
+		ResourceProcessorRead(d, meta)
+		return err
 	}
 
 	return ResourceProcessorRead(d, meta)
@@ -249,9 +388,81 @@ func ResourceProcessorExists(d *schema.ResourceData, meta interface{}) (bool, er
 	return true, nil
 }
 
+// Run Status Helpers
+
+func ProcessorApplyRunStatus(client *Client, processor *Processor, runStatus string) error {
+	state := processor.Component.State
+	if state == runStatus {
+		return nil
+	}
+
+	// Disabled processors have to be enabled (stopped) before they can be scheduled,
+	// running processors have to be stopped before they can be disabled or run once.
+	if "DISABLED" == state || "RUNNING" == state {
+		err := client.StopProcessor(processor)
+		if nil != err {
+			return err
+		}
+	}
+
+	switch runStatus {
+	case "RUNNING":
+		return client.StartProcessor(processor)
+	case "DISABLED":
+		return client.DisableProcessor(processor)
+	case "RUN_ONCE":
+		return client.RunProcessorOnce(processor)
+	}
+	return nil
+}
+
+// Validation Helpers
+
+// Logs a warning for invalid processors that are supposed to run, or returns an error if fail_on_invalid is set.
+func ProcessorCheckValidation(ctx context.Context, client *Client, d *schema.ResourceData, runStatus string) error {
+	if "RUNNING" != runStatus && "RUN_ONCE" != runStatus {
+		return nil
+	}
+	failOnInvalid := d.Get("fail_on_invalid").(bool)
+
+	// Processors are validated asynchronously by newer NiFi versions
+	processorId := d.Id()
+	processor := ProcessorStub()
+	err := client.WaitForAsyncRequest(ctx, AsyncRequest{
+		Name: fmt.Sprintf("Processor %s validation", processorId),
+		Poll: func() (AsyncRequestStatus, error) {
+			current, err := client.GetProcessor(processorId)
+			if nil != err {
+				return AsyncRequestStatus{}, err
+			}
+			processor = current
+			return AsyncRequestStatus{
+				Finished: "VALIDATING" != processor.Component.ValidationStatus,
+				State:    processor.Component.ValidationStatus,
+			}, nil
+		},
+		Timeout: 30 * time.Second,
+	})
+	message := ""
+	if nil != err {
+		message = fmt.Sprintf("Processor %s validation has not completed: %s", processorId, err)
+	} else if "INVALID" == processor.Component.ValidationStatus {
+		message = fmt.Sprintf("Processor %s is invalid and cannot be started: %s",
+			processorId, strings.Join(processor.Component.ValidationErrors, "; "))
+	} else {
+		return nil
+	}
+
+	if failOnInvalid {
+		return fmt.Errorf("%s", message)
+	}
+	log.Printf("[WARN] %s", message)
+	return nil
+}
+
 // Connection Helpers
 
-func ProcessorRemoveOverlappingConnections(client *Client, processor *Processor) error {
+func ProcessorRemoveOverlappingConnections(ctx context.Context, client *Client, processor *Processor) error {
 	// Build a set of processor's auto-terminated relationships
 	terminatedRelationships := map[string]bool{}
 	for _, v := range processor.Component.Config.AutoTerminatedRelationships {
@@ -291,7 +502,7 @@ func ProcessorRemoveOverlappingConnections(client *Client, processor *Processor)
 	for _, connection := range overlappingConnections {
 		// Stop destination processor
 		//err = ConnectionStopProcessor(client, connection.Component.Destination.Id)
-		err = client.StopConnectionHand(&connection.Component.Destination)
+		destinationRunning, err := client.StopConnectionHand(ctx, &connection.Component.Destination)
 		if nil != err {
 			log.Printf("[INFO] Failed to stop Processor: %s", connection.Component.Destination.Id)
 			continue
@@ -313,7 +524,7 @@ func ProcessorRemoveOverlappingConnections(client *Client, processor *Processor)
 			}
 		} else {
 			// Purge connection data
-			err = client.DropConnectionData(&connection)
+			err = client.DropConnectionData(ctx, &connection)
 			if nil != err {
 				log.Printf("[INFO] Error purging Connection: %s", connection.Component.Id)
 			}
@@ -325,11 +536,13 @@ func ProcessorRemoveOverlappingConnections(client *Client, processor *Processor)
 			}
 		}
 
-		// Start destination processor
+		// Start destination processor if it was running
 		//err = ConnectionStartProcessor(client, connection.Component.Destination.Id)
-		err = client.StartConnectionHand(&connection.Component.Destination)
-		if nil != err {
-			log.Printf("[INFO] Failed to start Processor: %s", connection.Component.Destination.Id)
+		if destinationRunning {
+			err = client.StartConnectionHand(ctx, &connection.Component.Destination)
+			if nil != err {
+				log.Printf("[INFO] Failed to start Processor: %s", connection.Component.Destination.Id)
+			}
 		}
 	}
 
@@ -366,6 +579,30 @@ func ProcessorFromSchema(d *schema.ResourceData, processor *Processor) error {
 	processor.Component.Config.SchedulingPeriod = config["scheduling_period"].(string)
 	processor.Component.Config.ExecutionNode = config["execution_node"].(string)
 	processor.Component.Config.ConcurrentlySchedulableTaskCount = config["concurrently_schedulable_task_count"].(int)
+	processor.Component.Config.PenaltyDuration = config["penalty_duration"].(string)
+	processor.Component.Config.YieldDuration = config["yield_duration"].(string)
+	processor.Component.Config.BulletinLevel = config["bulletin_level"].(string)
+	processor.Component.Config.RunDurationMillis = config["run_duration_millis"].(int)
+	processor.Component.Config.Comments = config["comments"].(string)
+	processor.Component.Config.AnnotationData = config["annotation_data"].(string)
+	processor.Component.Config.LossTolerant = config["loss_tolerant"].(bool)
+
+	retriedRelationships := []string{}
+	for _, v := range config["retried_relationships"].([]interface{}) {
+		retriedRelationships = append(retriedRelationships, v.(string))
+	}
+	processor.Component.Config.RetriedRelationships = nil
+	processor.Component.Config.RetryCount = nil
+	processor.Component.Config.BackoffMechanism = ""
+	processor.Component.Config.MaxBackoffPeriod = ""
+	// Retry settings are sent only when configured, or when retried relationships are being removed
+	if len(retriedRelationships) > 0 || d.HasChange("component.0.config.0.retried_relationships") {
+		retryCount := config["retry_count"].(int)
+		processor.Component.Config.RetriedRelationships = &retriedRelationships
+		processor.Component.Config.RetryCount = &retryCount
+		processor.Component.Config.BackoffMechanism = config["backoff_mechanism"].(string)
+		processor.Component.Config.MaxBackoffPeriod = config["max_backoff_period"].(string)
+	}
 
 	processor.Component.Config.Properties = map[string]interface{}{}
 	properties := config["properties"].(map[string]interface{})
@@ -383,17 +620,50 @@ func ProcessorFromSchema(d *schema.ResourceData, processor *Processor) error {
 	return nil
 }
 
+func ProcessorRunStatusFromSchema(d *schema.ResourceData) string {
+	v := d.Get("component").([]interface{})
+	if len(v) != 1 {
+		return ""
+	}
+	component := v[0].(map[string]interface{})
+	runStatus, _ := component["run_status"].(string)
+	return runStatus
+}
+
 func ProcessorToSchema(d *schema.ResourceData, processor *Processor) error {
 	revision := []map[string]interface{}{{
 		"version": processor.Revision.Version,
 	}}
 	d.Set("revision", revision)
+	validationErrors := []interface{}{}
+	for _, v := range processor.Component.ValidationErrors {
+		validationErrors = append(validationErrors, v)
+	}
+	d.Set("validation_status", processor.Component.ValidationStatus)
+	d.Set("validation_errors", validationErrors)
 
 	relationships := []interface{}{}
 	for _, v := range processor.Component.Config.AutoTerminatedRelationships {
 		relationships = append(relationships, v)
 	}
 
+	retriedRelationships := []interface{}{}
+	if nil != processor.Component.Config.RetriedRelationships {
+		for _, v := range *processor.Component.Config.RetriedRelationships {
+			retriedRelationships = append(retriedRelationships, v)
+		}
+	}
+	retryCount := 0
+	if nil != processor.Component.Config.RetryCount {
+		retryCount = *processor.Component.Config.RetryCount
+	}
+
+	// A processor that was run once goes back to STOPPED state after that
+	runStatus := processor.Component.State
+	if "STOPPED" == runStatus && "RUN_ONCE" == ProcessorRunStatusFromSchema(d) {
+		runStatus = "RUN_ONCE"
+	}
+
 	component := []map[string]interface{}{{
 		"parent_group_id": d.Get("parent_group_id").(string),
 		"name":            processor.Component.Name,
@@ -402,11 +672,23 @@ func ProcessorToSchema(d *schema.ResourceData, processor *Processor) error {
 			"x": processor.Component.Position.X,
 			"y": processor.Component.Position.Y,
 		}},
+		"run_status": runStatus,
 		"config": []map[string]interface{}{{
 			"concurrently_schedulable_task_count": processor.Component.Config.ConcurrentlySchedulableTaskCount,
 			"scheduling_strategy":                 processor.Component.Config.SchedulingStrategy,
 			"scheduling_period":                   processor.Component.Config.SchedulingPeriod,
 			"execution_node":                      processor.Component.Config.ExecutionNode,
+			"penalty_duration":                    processor.Component.Config.PenaltyDuration,
+			"yield_duration":                      processor.Component.Config.YieldDuration,
+			"bulletin_level":                      processor.Component.Config.BulletinLevel,
+			"run_duration_millis":                 processor.Component.Config.RunDurationMillis,
+			"comments":                            processor.Component.Config.Comments,
+			"annotation_data":                     processor.Component.Config.AnnotationData,
+			"loss_tolerant":                       processor.Component.Config.LossTolerant,
+			"retried_relationships":               retriedRelationships,
+			"retry_count":                         retryCount,
+			"backoff_mechanism":                   processor.Component.Config.BackoffMechanism,
+			"max_backoff_period":                  processor.Component.Config.MaxBackoffPeriod,
 			"properties":                          processor.Component.Config.Properties,
 			"auto_terminated_relationships":       relationships,
 		}},
@@ -1,8 +1,11 @@
 package nifi
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/terraform/helper/schema"
 )
@@ -15,9 +18,36 @@ func ResourceRemoteProcessGroup() *schema.Resource {
 		Delete: ResourceRemoteProcessGroupDelete,
 		Exists: ResourceRemoteProcessGroupExists,
 
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(10 * time.Minute),
+		},
+
 		Schema: map[string]*schema.Schema{
 			"parent_group_id": SchemaParentGroupId(),
 			"revision":        SchemaRevision(),
+			"delete_strategy": SchemaDeleteStrategy(),
+			"remote_input_port_names": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"remote_input_port_ids": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"remote_output_port_names": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"remote_output_port_ids": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
 			"component": {
 				Type:     schema.TypeList,
 				Required: true,
@@ -41,6 +71,45 @@ func ResourceRemoteProcessGroup() *schema.Resource {
 							Optional: true,
 							Default:  "http",
 						},
+						// Transmission is left as is unless specified
+						"transmitting": {
+							Type:     schema.TypeBool,
+							Optional: true,
+							Computed: true,
+						},
+						"communications_timeout": {
+							Type:     schema.TypeString,
+							Optional: true,
+							Default:  "30 sec",
+						},
+						"yield_duration": {
+							Type:     schema.TypeString,
+							Optional: true,
+							Default:  "10 sec",
+						},
+						"proxy_host": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"proxy_port": {
+							Type:     schema.TypeInt,
+							Optional: true,
+						},
+						"proxy_user": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"proxy_password": {
+							Type:      schema.TypeString,
+							Optional:  true,
+							Sensitive: true,
+						},
+						"local_network_interface": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"input_port":  SchemaRemoteProcessGroupPort(),
+						"output_port": SchemaRemoteProcessGroupPort(),
 					},
 				},
 			},
@@ -67,6 +136,25 @@ func ResourceRemoteProcessGroupCreate(d *schema.ResourceData, meta interface{})
 	d.SetId(processGroup.Component.Id)
 	d.Set("parent_group_id", parentGroupId)
 
+	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutCreate))
+	defer cancel()
+
+	// Connections to remote ports created in the same apply need those to be discovered
+	_, err = client.WaitForRemoteProcessGroupContents(ctx, processGroup.Component.Id, RemoteProcessGroupConfiguredPorts(d))
+	if err != nil {
+		return fmt.Errorf("Failed to refresh Remote Process Group %s: %s", processGroup.Component.Id, err)
+	}
+
+	err = RemoteProcessGroupConfigurePorts(client, d)
+	if err != nil {
+		return fmt.Errorf("Failed to configure ports of Remote Process Group %s: %s", processGroup.Component.Id, err)
+	}
+
+	err = RemoteProcessGroupApplyTransmission(client, d)
+	if err != nil {
+		return fmt.Errorf("Failed to set Remote Process Group %s transmission: %s", processGroup.Component.Id, err)
+	}
+
 	return ResourceRemoteProcessGroupRead(d, meta)
 }
 
@@ -79,6 +167,11 @@ func ResourceRemoteProcessGroupRead(d *schema.ResourceData, meta interface{}) er
 		return fmt.Errorf("Error retrieving Remote Process Group: %s", processGroupId)
 	}
 
+	// Desired transmission comes from the configuration or the last known state
+	if _, ok := d.GetOk("component"); ok {
+		client.SetDesiredRunStatus(processGroupId, RemoteProcessGroupRunStatusFromSchema(d))
+	}
+
 	err = RemoteProcessGroupToSchema(d, processGroup)
 	if err != nil {
 		return fmt.Errorf("Failed to serialize Remote Process Group: %s", processGroupId)
@@ -88,6 +181,16 @@ func ResourceRemoteProcessGroupRead(d *schema.ResourceData, meta interface{}) er
 }
 
 func ResourceRemoteProcessGroupUpdate(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Client)
+	client.Lock.Lock()
+	log.Printf("[INFO] Updating Remote Process Group: %s...", d.Id())
+	err := ResourceRemoteProcessGroupUpdateInternal(d, meta)
+	log.Printf("[INFO] Remote Process Group updated: %s", d.Id())
+	defer client.Lock.Unlock()
+	return err
+}
+
+func ResourceRemoteProcessGroupUpdateInternal(d *schema.ResourceData, meta interface{}) error {
 	processGroupId := d.Id()
 
 	client := meta.(*Client)
@@ -101,37 +204,46 @@ func ResourceRemoteProcessGroupUpdate(d *schema.ResourceData, meta interface{})
 		}
 	}
 
-	err = RemoteProcessGroupFromSchema(d, processGroup)
+	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutUpdate))
+	defer cancel()
+
+	err = RemoteProcessGroupUpdate(ctx, client, d, processGroup)
 	if err != nil {
-		return fmt.Errorf("Failed to parse Remote Process Group schema: %s", processGroupId)
+		return err
 	}
 
-	err = client.UpdateRemoteProcessGroup(processGroup)
+	err = RemoteProcessGroupApplyTransmission(client, d)
 	if err != nil {
-		return fmt.Errorf("Failed to update Remote Process Group: %s", processGroupId)
+		return fmt.Errorf("Failed to set Remote Process Group %s transmission: %s", processGroupId, err)
 	}
 
 	return ResourceRemoteProcessGroupRead(d, meta)
 }
 
 func ResourceRemoteProcessGroupDelete(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Client)
+	client.Lock.Lock()
+	log.Printf("[INFO] Deleting Remote Process Group: %s", d.Id())
+	err := ResourceRemoteProcessGroupDeleteInternal(d, meta)
+	log.Printf("[INFO] Remote Process Group deleted: %s", d.Id())
+	defer client.Lock.Unlock()
+	return err
+}
+
+func ResourceRemoteProcessGroupDeleteInternal(d *schema.ResourceData, meta interface{}) error {
 	processGroupId := d.Id()
-	log.Printf("[INFO] Deleting Remote Process Group: %s", processGroupId)
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutDelete))
+	defer cancel()
 
 	client := meta.(*Client)
-	processGroup, err := client.GetRemoteProcessGroup(processGroupId)
+	err := RemoteProcessGroupDelete(ctx, client, processGroupId, ConnectionDeleteStrategy(d))
 	if nil != err {
 		if "not_found" == err.Error() {
 			d.SetId("")
 			return nil
-		} else {
-			return fmt.Errorf("Error retrieving Remote Process Group: %s", processGroupId)
 		}
-	}
-
-	err = client.DeleteRemoteProcessGroup(processGroup)
-	if err != nil {
-		return fmt.Errorf("Error deleting Remote Process Group: %s", processGroupId)
+		return fmt.Errorf("Error deleting Remote Process Group %s: %s", processGroupId, err)
 	}
 
 	d.SetId("")
@@ -177,12 +289,75 @@ func RemoteProcessGroupFromSchema(d *schema.ResourceData, processGroup *RemotePr
 	processGroup.Component.Position.X = position["x"].(float64)
 	processGroup.Component.Position.Y = position["y"].(float64)
 
-	processGroup.Component.TargetUris = component["targetUris"].(string)
-	processGroup.Component.TransportProtocol = component["transportProtocol"].(string)
+	processGroup.Component.TargetUris = component["target_uris"].(string)
+	processGroup.Component.TransportProtocol = component["transport_protocol"].(string)
+	processGroup.Component.CommunicationsTimeout = component["communications_timeout"].(string)
+	processGroup.Component.YieldDuration = component["yield_duration"].(string)
+	processGroup.Component.ProxyHost = component["proxy_host"].(string)
+	processGroup.Component.ProxyPort = component["proxy_port"].(int)
+	processGroup.Component.ProxyUser = component["proxy_user"].(string)
+	processGroup.Component.ProxyPassword = component["proxy_password"].(string)
+	processGroup.Component.LocalNetworkInterface = component["local_network_interface"].(string)
 
 	return nil
 }
 
+func RemoteProcessGroupRunStatusFromSchema(d *schema.ResourceData) string {
+	v := d.Get("component").([]interface{})
+	if len(v) != 1 {
+		return "STOPPED"
+	}
+	component := v[0].(map[string]interface{})
+	if transmitting, _ := component["transmitting"].(bool); transmitting {
+		return "TRANSMITTING"
+	}
+	return "STOPPED"
+}
+
+func RemoteProcessGroupPortsFromSchema(d *schema.ResourceData, key string) []map[string]interface{} {
+	v := d.Get("component").([]interface{})
+	if len(v) != 1 {
+		return nil
+	}
+	component := v[0].(map[string]interface{})
+	blocks, _ := component[key].([]interface{})
+	ports := []map[string]interface{}{}
+	for _, block := range blocks {
+		if port, ok := block.(map[string]interface{}); ok {
+			ports = append(ports, port)
+		}
+	}
+	return ports
+}
+
+func RemoteProcessGroupPortFromSchema(block map[string]interface{}, port *RemoteProcessGroupPort) {
+	useCompression := block["use_compression"].(bool)
+	port.ConcurrentlySchedulableTaskCount = block["concurrently_schedulable_task_count"].(int)
+	port.UseCompression = &useCompression
+	port.BatchSettings = &RemoteProcessGroupBatchSettings{
+		Count:    block["batch_count"].(int),
+		Size:     block["batch_size"].(string),
+		Duration: block["batch_duration"].(string),
+	}
+}
+
+func RemoteProcessGroupPortToSchema(name string, port *RemoteProcessGroupPort) map[string]interface{} {
+	block := map[string]interface{}{
+		"name":                                name,
+		"concurrently_schedulable_task_count": port.ConcurrentlySchedulableTaskCount,
+		"use_compression":                     nil != port.UseCompression && *port.UseCompression,
+		"batch_count":                         0,
+		"batch_size":                          "",
+		"batch_duration":                      "",
+	}
+	if nil != port.BatchSettings {
+		block["batch_count"] = port.BatchSettings.Count
+		block["batch_size"] = port.BatchSettings.Size
+		block["batch_duration"] = port.BatchSettings.Duration
+	}
+	return block
+}
+
 func RemoteProcessGroupToSchema(d *schema.ResourceData, processGroup *RemoteProcessGroup) error {
 	revision := []map[string]interface{}{{
 		"version": processGroup.Revision.Version,
@@ -196,10 +371,341 @@ func RemoteProcessGroupToSchema(d *schema.ResourceData, processGroup *RemoteProc
 			"x": processGroup.Component.Position.X,
 			"y": processGroup.Component.Position.Y,
 		}},
-		"targetUris":        processGroup.Component.TargetUris,
-		"transportProtocol": processGroup.Component.TransportProtocol,
+		"target_uris":             processGroup.Component.TargetUris,
+		"transport_protocol":      processGroup.Component.TransportProtocol,
+		"transmitting":            nil != processGroup.Component.Transmitting && *processGroup.Component.Transmitting,
+		"communications_timeout":  processGroup.Component.CommunicationsTimeout,
+		"yield_duration":          processGroup.Component.YieldDuration,
+		"proxy_host":              processGroup.Component.ProxyHost,
+		"proxy_port":              processGroup.Component.ProxyPort,
+		"proxy_user":              processGroup.Component.ProxyUser,
+		"local_network_interface": processGroup.Component.LocalNetworkInterface,
 	}}
+
+	// Proxy password is never reported back by NiFi
+	v := d.Get("component").([]interface{})
+	if len(v) == 1 {
+		configured := v[0].(map[string]interface{})
+		component[0]["proxy_password"] = configured["proxy_password"]
+	}
+
+	contents := processGroup.Component.Contents
+	if nil == contents {
+		contents = &RemoteProcessGroupContents{}
+	}
+	d.Set("remote_input_port_names", RemoteProcessGroupPortNames(contents.InputPorts))
+	d.Set("remote_input_port_ids", RemoteProcessGroupPortIds(contents.InputPorts))
+	d.Set("remote_output_port_names", RemoteProcessGroupPortNames(contents.OutputPorts))
+	d.Set("remote_output_port_ids", RemoteProcessGroupPortIds(contents.OutputPorts))
+
+	// Only configured remote ports are reported, those are referenced by name or id
+	portBlocks := map[string][]RemoteProcessGroupPort{
+		"input_port":  contents.InputPorts,
+		"output_port": contents.OutputPorts,
+	}
+	for key, ports := range portBlocks {
+		blocks := []map[string]interface{}{}
+		for _, configured := range RemoteProcessGroupPortsFromSchema(d, key) {
+			name := configured["name"].(string)
+			for i, port := range ports {
+				if port.Id == name || port.TargetId == name || port.Name == name {
+					blocks = append(blocks, RemoteProcessGroupPortToSchema(name, &ports[i]))
+					break
+				}
+			}
+		}
+		component[0][key] = blocks
+	}
 	d.Set("component", component)
 
 	return nil
 }
+
+func RemoteProcessGroupPortNames(ports []RemoteProcessGroupPort) []interface{} {
+	names := []interface{}{}
+	for _, port := range ports {
+		names = append(names, port.Name)
+	}
+	return names
+}
+
+func RemoteProcessGroupPortIds(ports []RemoteProcessGroupPort) []interface{} {
+	ids := []interface{}{}
+	for _, port := range ports {
+		ids = append(ids, port.Id)
+	}
+	return ids
+}
+
+func SchemaRemoteProcessGroupPort() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"name": {
+					Type:     schema.TypeString,
+					Required: true,
+				},
+				"concurrently_schedulable_task_count": {
+					Type:     schema.TypeInt,
+					Optional: true,
+					Default:  1,
+				},
+				"use_compression": {
+					Type:     schema.TypeBool,
+					Optional: true,
+					Default:  false,
+				},
+				"batch_count": {
+					Type:     schema.TypeInt,
+					Optional: true,
+				},
+				"batch_size": {
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				"batch_duration": {
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+			},
+		},
+	}
+}
+
+// Remote Port Helpers
+
+var RemoteProcessGroupPortTypes = map[string]string{
+	"input_port":  "REMOTE_INPUT_PORT",
+	"output_port": "REMOTE_OUTPUT_PORT",
+}
+
+// Returns names of the ports configured by input_port and output_port blocks, by remote port type.
+func RemoteProcessGroupConfiguredPorts(d *schema.ResourceData) map[string][]string {
+	ports := map[string][]string{}
+	for key, portType := range RemoteProcessGroupPortTypes {
+		for _, block := range RemoteProcessGroupPortsFromSchema(d, key) {
+			ports[portType] = append(ports[portType], block["name"].(string))
+		}
+	}
+	return ports
+}
+
+// Applies settings of configured remote ports, ports are expected not to transmit at this point.
+func RemoteProcessGroupConfigurePorts(client *Client, d *schema.ResourceData) error {
+	processGroupId := d.Id()
+	for key, portType := range RemoteProcessGroupPortTypes {
+		for _, block := range RemoteProcessGroupPortsFromSchema(d, key) {
+			name := block["name"].(string)
+			processGroup, port, err := client.GetRemoteProcessGroupPort(processGroupId, portType, name)
+			if nil != err {
+				return err
+			}
+			RemoteProcessGroupPortFromSchema(block, port)
+			log.Printf("[INFO] Configuring Remote Process Group port: %s", port.Id)
+			err = client.UpdateRemoteProcessGroupPort(processGroup, portType, port)
+			if nil != err {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func RemoteProcessGroupApplyTransmission(client *Client, d *schema.ResourceData) error {
+	processGroupId := d.Id()
+	runStatus := RemoteProcessGroupRunStatusFromSchema(d)
+	client.SetDesiredRunStatus(processGroupId, runStatus)
+
+	processGroup, err := client.GetRemoteProcessGroup(processGroupId)
+	if nil != err {
+		return err
+	}
+	transmitting := nil != processGroup.Component.Transmitting && *processGroup.Component.Transmitting
+	if transmitting == ("TRANSMITTING" == runStatus) {
+		return nil
+	}
+	return client.SetRemoteProcessGroupTransmission(processGroup, !transmitting)
+}
+
+// Update Helpers
+
+// Remote ports can't be modified while transmitting. Ports that were transmitting are stopped when remote ports
+// or the target change and their transmission is restored afterwards, whether the update succeeds or not.
+func RemoteProcessGroupUpdate(ctx context.Context, client *Client, d *schema.ResourceData, processGroup *RemoteProcessGroup) (err error) {
+	processGroupId := processGroup.Component.Id
+	transmittingPorts := RemoteProcessGroupTransmittingPorts(processGroup)
+	if len(transmittingPorts) > 0 && (d.HasChange("component.0.target_uris") ||
+		d.HasChange("component.0.input_port") || d.HasChange("component.0.output_port")) {
+		err = client.SetRemoteProcessGroupTransmission(processGroup, false)
+		if err != nil {
+			return fmt.Errorf("Failed to stop Remote Process Group transmission: %s", processGroupId)
+		}
+		defer func() {
+			restoreErr := RemoteProcessGroupRestoreTransmission(client, processGroupId, transmittingPorts)
+			if nil == err && nil != restoreErr {
+				err = fmt.Errorf("Failed to restore Remote Process Group %s transmission: %s", processGroupId, restoreErr)
+			}
+		}()
+	}
+
+	err = RemoteProcessGroupFromSchema(d, processGroup)
+	if err != nil {
+		return fmt.Errorf("Failed to parse Remote Process Group schema: %s", processGroupId)
+	}
+
+	err = client.UpdateRemoteProcessGroup(processGroup)
+	if err != nil {
+		return fmt.Errorf("Failed to update Remote Process Group: %s", processGroupId)
+	}
+
+	// Newly configured ports or a new target have to be discovered first
+	_, err = client.WaitForRemoteProcessGroupContents(ctx, processGroupId, RemoteProcessGroupConfiguredPorts(d))
+	if err != nil {
+		return fmt.Errorf("Failed to refresh Remote Process Group %s: %s", processGroupId, err)
+	}
+
+	err = RemoteProcessGroupConfigurePorts(client, d)
+	if err != nil {
+		return fmt.Errorf("Failed to configure ports of Remote Process Group %s: %s", processGroupId, err)
+	}
+	return nil
+}
+
+// Returns names of transmitting remote ports, by remote port type.
+func RemoteProcessGroupTransmittingPorts(processGroup *RemoteProcessGroup) map[string][]string {
+	ports := map[string][]string{}
+	if nil == processGroup.Component.Contents {
+		return ports
+	}
+	for portType, contents := range map[string][]RemoteProcessGroupPort{
+		"REMOTE_INPUT_PORT":  processGroup.Component.Contents.InputPorts,
+		"REMOTE_OUTPUT_PORT": processGroup.Component.Contents.OutputPorts,
+	} {
+		for _, port := range contents {
+			if port.Transmitting {
+				ports[portType] = append(ports[portType], port.Name)
+			}
+		}
+	}
+	return ports
+}
+
+// Enables transmission of the given remote ports one by one, other ports are left alone.
+func RemoteProcessGroupRestoreTransmission(client *Client, processGroupId string, ports map[string][]string) error {
+	for portType, names := range ports {
+		for _, name := range names {
+			err := client.SetRemoteProcessGroupPortTransmission(processGroupId, portType, name, true)
+			if nil != err {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Delete Helpers
+
+// Stops transmission, empties connections attached to remote ports according to the delete strategy,
+// removes those connections and deletes the remote process group. NiFi refuses to delete transmitting
+// remote process groups or the ones with connected ports. Connections not managed by Terraform are never
+// touched, the removal fails listing them instead. fail_if_not_empty leaves everything intact if any
+// connection holds data.
+func RemoteProcessGroupDelete(ctx context.Context, client *Client, processGroupId string, deleteStrategy string) error {
+	processGroup, err := client.GetRemoteProcessGroup(processGroupId)
+	if nil != err {
+		return err
+	}
+
+	connections, err := RemoteProcessGroupConnections(client, processGroup)
+	if nil != err {
+		return err
+	}
+	unmanaged := []string{}
+	for _, connection := range connections {
+		if !client.IsConnectionManaged(connection.Component.Id) {
+			unmanaged = append(unmanaged, connection.Component.Id)
+		}
+	}
+	if len(unmanaged) > 0 {
+		return fmt.Errorf("Remote Process Group %s is connected by Connections not managed by Terraform, "+
+			"remove these first: %s", processGroupId, strings.Join(unmanaged, ", "))
+	}
+	if "fail_if_not_empty" == deleteStrategy {
+		for _, connection := range connections {
+			err = ConnectionEnsureEmpty(client, connection.Component.Id)
+			if nil != err {
+				return err
+			}
+		}
+	}
+
+	client.SetDesiredRunStatus(processGroupId, "STOPPED")
+	if nil != processGroup.Component.Transmitting && *processGroup.Component.Transmitting {
+		log.Printf("[INFO] Stopping Remote Process Group transmission: %s", processGroupId)
+		err = client.SetRemoteProcessGroupTransmission(processGroup, false)
+		if nil != err {
+			return err
+		}
+	}
+
+	for i := range connections {
+		connection := &connections[i]
+		connectionId := connection.Component.Id
+		log.Printf("[WARN] Removing Connection %s attached to Remote Process Group %s", connectionId, processGroupId)
+
+		// Nothing should enter the connection while it is being emptied
+		if processGroupId != connection.Component.Source.GroupId {
+			_, err = client.StopConnectionHand(ctx, &connection.Component.Source)
+			if nil != err {
+				return err
+			}
+		}
+
+		// Remote input ports have to transmit in order to drain connections leading to them
+		if "drain" == deleteStrategy && processGroupId == connection.Component.Destination.GroupId {
+			err = client.SetRemoteProcessGroupPortTransmission(processGroupId,
+				connection.Component.Destination.Type, connection.Component.Destination.Id, true)
+			if nil != err {
+				return err
+			}
+		}
+
+		err = ConnectionPurge(ctx, client, connection, deleteStrategy)
+		if nil != err {
+			return err
+		}
+
+		connection, err = client.GetConnection(connectionId)
+		if nil != err {
+			return err
+		}
+		err = client.DeleteConnection(connection)
+		if nil != err {
+			return err
+		}
+	}
+
+	// Refresh revision, it changes with every transmission and connection change
+	processGroup, err = client.GetRemoteProcessGroup(processGroupId)
+	if nil != err {
+		return err
+	}
+	return client.DeleteRemoteProcessGroup(processGroup)
+}
+
+func RemoteProcessGroupConnections(client *Client, processGroup *RemoteProcessGroup) ([]Connection, error) {
+	connections, err := client.GetProcessGroupConnections(processGroup.Component.ParentGroupId)
+	if nil != err {
+		return nil, err
+	}
+	processGroupId := processGroup.Component.Id
+	result := []Connection{}
+	for _, connection := range connections.Connections {
+		if processGroupId == connection.Component.Source.GroupId || processGroupId == connection.Component.Destination.GroupId {
+			result = append(result, connection)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,329 @@
+package nifi
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// Local stand-in for a NiFi instance with a single remote process group (rpg1) in process group pg1.
+// Connection conn1 leads from processor proc1 to remote input port rport1, conn2 is unrelated to rpg1.
+// NiFi's own rules are enforced: transmitting remote process groups and non-empty connections can't be deleted.
+type fakeNifi struct {
+	sync.Mutex
+	server *httptest.Server
+	calls  []string
+
+	transmitting      bool
+	portTransmitting  bool
+	queued            int
+	connectionDeleted bool
+	rpgDeleted        bool
+}
+
+func newFakeNifi() *fakeNifi {
+	fake := &fakeNifi{}
+	fake.server = httptest.NewServer(http.HandlerFunc(fake.serve))
+	return fake
+}
+
+func (f *fakeNifi) serve(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	call := r.Method + " " + r.URL.Path
+	f.calls = append(f.calls, call)
+
+	switch call {
+	case "GET /nifi-api/remote-process-groups/rpg1":
+		if f.rpgDeleted {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(f.remoteProcessGroup())
+	case "PUT /nifi-api/remote-process-groups/rpg1/run-status":
+		update := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&update)
+		// Group run status applies to all of its ports
+		f.transmitting = "TRANSMITTING" == update["state"]
+		f.portTransmitting = f.transmitting
+		json.NewEncoder(w).Encode(f.remoteProcessGroup())
+	case "PUT /nifi-api/remote-process-groups/rpg1/input-ports/rport1":
+		update := RemoteProcessGroupPortUpdate{}
+		json.NewDecoder(r.Body).Decode(&update)
+		f.portTransmitting = update.RemoteProcessGroupPort.Transmitting
+		json.NewEncoder(w).Encode(update)
+	case "DELETE /nifi-api/remote-process-groups/rpg1":
+		if f.transmitting || !f.connectionDeleted {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.rpgDeleted = true
+		json.NewEncoder(w).Encode(f.remoteProcessGroup())
+	case "GET /nifi-api/process-groups/pg1/connections":
+		connections := Connections{Connections: []Connection{f.unrelatedConnection()}}
+		if !f.connectionDeleted {
+			connections.Connections = append(connections.Connections, f.connection())
+		}
+		json.NewEncoder(w).Encode(connections)
+	case "GET /nifi-api/processors/proc1":
+		processor := Processor{}
+		processor.Component.Id = "proc1"
+		processor.Component.State = "STOPPED"
+		json.NewEncoder(w).Encode(processor)
+	case "GET /nifi-api/flow/connections/conn1/status":
+		status := ConnectionStatus{}
+		status.ConnectionStatus.Id = "conn1"
+		status.ConnectionStatus.AggregateSnapshot.FlowFilesQueued = f.queued
+		json.NewEncoder(w).Encode(status)
+		// Transmitting port sends queued FlowFiles to the target instance
+		if f.portTransmitting {
+			f.queued = 0
+		}
+	case "POST /nifi-api/flowfile-queues/conn1/drop-requests":
+		f.queued = 0
+		json.NewEncoder(w).Encode(f.dropRequest())
+	case "GET /nifi-api/flowfile-queues/conn1/drop-requests/drop1",
+		"DELETE /nifi-api/flowfile-queues/conn1/drop-requests/drop1":
+		json.NewEncoder(w).Encode(f.dropRequest())
+	case "GET /nifi-api/connections/conn1":
+		json.NewEncoder(w).Encode(f.connection())
+	case "DELETE /nifi-api/connections/conn1":
+		if f.queued > 0 {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.connectionDeleted = true
+		json.NewEncoder(w).Encode(f.connection())
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeNifi) remoteProcessGroup() RemoteProcessGroup {
+	transmitting := f.transmitting
+	return RemoteProcessGroup{
+		Revision: Revision{
+			Version: 3,
+		},
+		Component: RemoteProcessGroupComponent{
+			Id:            "rpg1",
+			ParentGroupId: "pg1",
+			Transmitting:  &transmitting,
+			Contents: &RemoteProcessGroupContents{
+				InputPorts: []RemoteProcessGroupPort{{
+					Id:           "rport1",
+					Name:         "remote_in",
+					Transmitting: f.portTransmitting,
+				}},
+			},
+		},
+	}
+}
+
+func (f *fakeNifi) connection() Connection {
+	return Connection{
+		Revision: Revision{
+			Version: 2,
+		},
+		Component: ConnectionComponent{
+			Id:            "conn1",
+			ParentGroupId: "pg1",
+			Source:        ConnectionHand{Type: "PROCESSOR", Id: "proc1", GroupId: "pg1"},
+			Destination:   ConnectionHand{Type: "REMOTE_INPUT_PORT", Id: "rport1", GroupId: "rpg1"},
+		},
+	}
+}
+
+func (f *fakeNifi) unrelatedConnection() Connection {
+	return Connection{
+		Component: ConnectionComponent{
+			Id:            "conn2",
+			ParentGroupId: "pg1",
+			Source:        ConnectionHand{Type: "PROCESSOR", Id: "proc1", GroupId: "pg1"},
+			Destination:   ConnectionHand{Type: "PROCESSOR", Id: "proc2", GroupId: "pg1"},
+		},
+	}
+}
+
+func (f *fakeNifi) dropRequest() ConnectionDropRequest {
+	dropRequest := ConnectionDropRequest{}
+	dropRequest.DropRequest.Id = "drop1"
+	dropRequest.DropRequest.Finished = true
+	return dropRequest
+}
+
+func (f *fakeNifi) client() *Client {
+	return NewClient(Config{
+		Host:       f.server.Listener.Addr().String(),
+		ApiPath:    "nifi-api",
+		HttpScheme: "http",
+	})
+}
+
+// Returns a client managing conn1, as if the connection resource was read in the same run.
+func (f *fakeNifi) managingClient() *Client {
+	client := f.client()
+	client.SetConnectionManaged("conn1")
+	return client
+}
+
+// Returns the position of the first matching call, -1 if it was never made.
+func (f *fakeNifi) callIndex(call string) int {
+	f.Lock()
+	defer f.Unlock()
+	for i, c := range f.calls {
+		if c == call {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestClientRemoteProcessGroupDeleteUrl(t *testing.T) {
+	fake := newFakeNifi()
+	defer fake.server.Close()
+	fake.connectionDeleted = true
+
+	processGroup := fake.remoteProcessGroup()
+	err := fake.client().DeleteRemoteProcessGroup(&processGroup)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"DELETE /nifi-api/remote-process-groups/rpg1"}, fake.calls)
+	assert.True(t, fake.rpgDeleted)
+}
+
+func TestRemoteProcessGroupDeleteDrop(t *testing.T) {
+	fake := newFakeNifi()
+	defer fake.server.Close()
+	fake.transmitting = true
+	fake.queued = 5
+
+	err := RemoteProcessGroupDelete(context.Background(), fake.managingClient(), "rpg1", "drop")
+	assert.Nil(t, err)
+	assert.True(t, fake.rpgDeleted)
+	assert.True(t, fake.connectionDeleted)
+
+	stopTransmission := fake.callIndex("PUT /nifi-api/remote-process-groups/rpg1/run-status")
+	dropData := fake.callIndex("POST /nifi-api/flowfile-queues/conn1/drop-requests")
+	dropCleanup := fake.callIndex("DELETE /nifi-api/flowfile-queues/conn1/drop-requests/drop1")
+	assert.True(t, stopTransmission >= 0 && stopTransmission < dropData, "transmission was not stopped before the drop")
+	assert.True(t, dropData < dropCleanup, "drop request was not cleaned up")
+	assert.Equal(t, -1, fake.callIndex("DELETE /nifi-api/connections/conn2"))
+	assert.Equal(t, -1, fake.callIndex("DELETE /nifi-api/process-groups/rpg1"))
+}
+
+func TestRemoteProcessGroupDeleteDrain(t *testing.T) {
+	fake := newFakeNifi()
+	defer fake.server.Close()
+	fake.transmitting = true
+	fake.queued = 5
+
+	err := RemoteProcessGroupDelete(context.Background(), fake.managingClient(), "rpg1", "drain")
+	assert.Nil(t, err)
+	assert.True(t, fake.rpgDeleted)
+	assert.True(t, fake.connectionDeleted)
+	assert.False(t, fake.transmitting)
+	assert.False(t, fake.portTransmitting)
+
+	// The remote port alone transmits until the queue is empty, nothing is dropped
+	stopTransmission := fake.callIndex("PUT /nifi-api/remote-process-groups/rpg1/run-status")
+	portTransmission := fake.callIndex("PUT /nifi-api/remote-process-groups/rpg1/input-ports/rport1")
+	deleteConnection := fake.callIndex("DELETE /nifi-api/connections/conn1")
+	assert.True(t, stopTransmission >= 0 && stopTransmission < portTransmission, "transmission was not stopped before draining")
+	assert.True(t, portTransmission < deleteConnection, "connection was deleted before it was drained")
+	assert.Equal(t, -1, fake.callIndex("POST /nifi-api/flowfile-queues/conn1/drop-requests"))
+}
+
+func TestRemoteProcessGroupDeleteFailIfNotEmpty(t *testing.T) {
+	fake := newFakeNifi()
+	defer fake.server.Close()
+	fake.transmitting = true
+	fake.queued = 5
+
+	err := RemoteProcessGroupDelete(context.Background(), fake.managingClient(), "rpg1", "fail_if_not_empty")
+	assert.NotNil(t, err)
+	assert.True(t, fake.transmitting)
+	assert.False(t, fake.connectionDeleted)
+	assert.False(t, fake.rpgDeleted)
+	assert.Equal(t, 5, fake.queued)
+
+	fake.queued = 0
+	err = RemoteProcessGroupDelete(context.Background(), fake.managingClient(), "rpg1", "fail_if_not_empty")
+	assert.Nil(t, err)
+	assert.True(t, fake.connectionDeleted)
+	assert.True(t, fake.rpgDeleted)
+}
+
+func TestRemoteProcessGroupDeleteUnmanagedConnection(t *testing.T) {
+	fake := newFakeNifi()
+	defer fake.server.Close()
+	fake.transmitting = true
+	fake.queued = 5
+
+	// Connections not managed by Terraform are listed instead of being emptied and removed
+	err := RemoteProcessGroupDelete(context.Background(), fake.client(), "rpg1", "drop")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "conn1")
+	assert.True(t, fake.transmitting)
+	assert.Equal(t, 5, fake.queued)
+	assert.False(t, fake.connectionDeleted)
+	assert.False(t, fake.rpgDeleted)
+}
+
+func TestRemoteProcessGroupDeleteNotFound(t *testing.T) {
+	fake := newFakeNifi()
+	defer fake.server.Close()
+	fake.rpgDeleted = true
+
+	err := RemoteProcessGroupDelete(context.Background(), fake.managingClient(), "rpg1", "drop")
+	assert.NotNil(t, err)
+	assert.Equal(t, "not_found", err.Error())
+}
+
+func TestClientRemoteConnectionHandRestore(t *testing.T) {
+	fake := newFakeNifi()
+	defer fake.server.Close()
+	hand := ConnectionHand{Type: "REMOTE_INPUT_PORT", Id: "rport1", GroupId: "rpg1"}
+
+	// Ports that were not transmitting are not supposed to be started again
+	running, err := fake.client().StopConnectionHand(context.Background(), &hand)
+	assert.Nil(t, err)
+	assert.False(t, running)
+	assert.Equal(t, -1, fake.callIndex("PUT /nifi-api/remote-process-groups/rpg1/input-ports/rport1"))
+
+	fake.portTransmitting = true
+	running, err = fake.client().StopConnectionHand(context.Background(), &hand)
+	assert.Nil(t, err)
+	assert.True(t, running)
+	assert.False(t, fake.portTransmitting)
+
+	err = fake.client().StartConnectionHand(context.Background(), &hand)
+	assert.Nil(t, err)
+	assert.True(t, fake.portTransmitting)
+}
+
+func TestRemoteProcessGroupRestoreTransmission(t *testing.T) {
+	fake := newFakeNifi()
+	defer fake.server.Close()
+	client := fake.client()
+
+	fake.transmitting = true
+	fake.portTransmitting = true
+	processGroup, err := client.GetRemoteProcessGroup("rpg1")
+	assert.Nil(t, err)
+	ports := RemoteProcessGroupTransmittingPorts(processGroup)
+	assert.Equal(t, map[string][]string{"REMOTE_INPUT_PORT": {"remote_in"}}, ports)
+
+	err = client.SetRemoteProcessGroupTransmission(processGroup, false)
+	assert.Nil(t, err)
+	assert.False(t, fake.portTransmitting)
+
+	// Ports are enabled one by one instead of the whole group
+	err = RemoteProcessGroupRestoreTransmission(client, "rpg1", ports)
+	assert.Nil(t, err)
+	assert.True(t, fake.portTransmitting)
+	assert.Equal(t, "PUT /nifi-api/remote-process-groups/rpg1/input-ports/rport1", fake.calls[len(fake.calls)-1])
+}
@@ -1,8 +1,10 @@
 package nifi
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/hashicorp/terraform/helper/schema"
 )
@@ -15,6 +17,12 @@ func ResourceReportingTask() *schema.Resource {
 		Delete: ResourceReportingTaskDelete,
 		Exists: ResourceReportingTaskExists,
 
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(10 * time.Minute),
+			Update: schema.DefaultTimeout(10 * time.Minute),
+			Delete: schema.DefaultTimeout(10 * time.Minute),
+		},
+
 		Schema: map[string]*schema.Schema{
 			"parent_group_id": SchemaParentGroupId(),
 			"revision":        SchemaRevision(),
@@ -53,6 +61,12 @@ func ResourceReportingTask() *schema.Resource {
 							Type:     schema.TypeMap,
 							Required: true,
 						},
+						"run_status": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							Default:      "STOPPED",
+							ValidateFunc: ValidateStringInSlice([]string{"RUNNING", "STOPPED", "DISABLED"}),
+						},
 					},
 				},
 			},
@@ -79,6 +93,14 @@ func ResourceReportingTaskCreate(d *schema.ResourceData, meta interface{}) error
 	d.SetId(reportingTask.Component.Id)
 	d.Set("parent_group_id", parentGroupId)
 
+	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutCreate))
+	defer cancel()
+	runStatus := ReportingTaskRunStatusFromSchema(d)
+	err = ReportingTaskApplyRunStatus(ctx, client, &reportingTask, runStatus)
+	if err != nil {
+		log.Printf("[INFO] Failed to set Reporting Task %s run status to %s", reportingTask.Component.Id, runStatus)
+	}
+
 	return ResourceReportingTaskRead(d, meta)
 }
 
@@ -113,6 +135,17 @@ func ResourceReportingTaskUpdate(d *schema.ResourceData, meta interface{}) error
 		}
 	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutUpdate))
+	defer cancel()
+
+	// Running reporting tasks can't be modified
+	if "RUNNING" == reportingTask.Component.State {
+		err = ReportingTaskApplyRunStatus(ctx, client, reportingTask, "STOPPED")
+		if err != nil {
+			return fmt.Errorf("Failed to stop Reporting Task: %s", reportingTaskId)
+		}
+	}
+
 	err = ReportingTaskFromSchema(d, reportingTask)
 	if err != nil {
 		return fmt.Errorf("Failed to parse Reporting Task schema: %s", reportingTaskId)
@@ -123,6 +156,12 @@ func ResourceReportingTaskUpdate(d *schema.ResourceData, meta interface{}) error
 		return fmt.Errorf("Failed to update Reporting Task: %s", reportingTaskId)
 	}
 
+	runStatus := ReportingTaskRunStatusFromSchema(d)
+	err = ReportingTaskApplyRunStatus(ctx, client, reportingTask, runStatus)
+	if err != nil {
+		return fmt.Errorf("Failed to set Reporting Task %s run status to %s", reportingTaskId, runStatus)
+	}
+
 	return ResourceReportingTaskRead(d, meta)
 }
 
@@ -141,6 +180,15 @@ func ResourceReportingTaskDelete(d *schema.ResourceData, meta interface{}) error
 		}
 	}
 
+	if "RUNNING" == reportingTask.Component.State {
+		ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutDelete))
+		defer cancel()
+		err = ReportingTaskApplyRunStatus(ctx, client, reportingTask, "STOPPED")
+		if err != nil {
+			return fmt.Errorf("Failed to stop Reporting Task: %s", reportingTaskId)
+		}
+	}
+
 	err = client.DeleteReportingTask(reportingTask)
 	if err != nil {
 		return fmt.Errorf("Error deleting Reporting Task: %s", reportingTaskId)
@@ -194,6 +242,19 @@ func ReportingTaskFromSchema(d *schema.ResourceData, reportingTask *ReportingTas
 	return nil
 }
 
+func ReportingTaskRunStatusFromSchema(d *schema.ResourceData) string {
+	v := d.Get("component").([]interface{})
+	if len(v) != 1 {
+		return "STOPPED"
+	}
+	component := v[0].(map[string]interface{})
+	runStatus, _ := component["run_status"].(string)
+	if "" == runStatus {
+		return "STOPPED"
+	}
+	return runStatus
+}
+
 func ReportingTaskToSchema(d *schema.ResourceData, reportingTask *ReportingTask) error {
 	revision := []map[string]interface{}{{
 		"version": reportingTask.Revision.Version,
@@ -207,8 +268,45 @@ func ReportingTaskToSchema(d *schema.ResourceData, reportingTask *ReportingTask)
 		"properties":          reportingTask.Component.Properties,
 		"scheduling_strategy": reportingTask.Component.SchedulingStrategy,
 		"scheduling_period":   reportingTask.Component.SchedulingPeriod,
+		"run_status":          reportingTask.Component.State,
 	}}
 	d.Set("component", component)
 
 	return nil
 }
+
+// State Helpers
+
+func ReportingTaskApplyRunStatus(ctx context.Context, client *Client, reportingTask *ReportingTask, runStatus string) error {
+	state := reportingTask.Component.State
+	if state == runStatus {
+		return nil
+	}
+
+	// Disabled reporting tasks have to be enabled (stopped) before they can be scheduled,
+	// running reporting tasks have to be stopped before they can be disabled.
+	if "DISABLED" == state || "RUNNING" == state {
+		err := client.StopReportingTask(reportingTask)
+		if nil != err {
+			return err
+		}
+		err = client.WaitForReportingTaskState(ctx, reportingTask, "STOPPED")
+		if nil != err {
+			return err
+		}
+	}
+
+	var err error
+	switch runStatus {
+	case "RUNNING":
+		err = client.StartReportingTask(reportingTask)
+	case "DISABLED":
+		err = client.DisableReportingTask(reportingTask)
+	default:
+		return nil
+	}
+	if nil != err {
+		return err
+	}
+	return client.WaitForReportingTaskState(ctx, reportingTask, runStatus)
+}
@@ -1,6 +1,10 @@
 package nifi
 
-import "github.com/hashicorp/terraform/helper/schema"
+import (
+	"fmt"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
 
 func SchemaParentGroupId() *schema.Schema {
 	return &schema.Schema{
@@ -24,6 +28,15 @@ func SchemaRevision() *schema.Schema {
 	}
 }
 
+func SchemaDeleteStrategy() *schema.Schema {
+	return &schema.Schema{
+		Type:         schema.TypeString,
+		Optional:     true,
+		Default:      "drop",
+		ValidateFunc: ValidateStringInSlice([]string{"drop", "drain", "fail_if_not_empty"}),
+	}
+}
+
 func SchemaPosition() *schema.Schema {
 	return &schema.Schema{
 		Type:     schema.TypeList,
@@ -42,3 +55,26 @@ func SchemaPosition() *schema.Schema {
 		},
 	}
 }
+
+func ValidateStringInSlice(valid []string) schema.SchemaValidateFunc {
+	return func(v interface{}, k string) ([]string, []error) {
+		value := v.(string)
+		for _, s := range valid {
+			if s == value {
+				return nil, nil
+			}
+		}
+		return nil, []error{fmt.Errorf("%s must be one of %v, got: %s", k, valid, value)}
+	}
+}
+
+// Returns component's desired parent group id, those differ from the current one when a component is moved.
+func ComponentParentGroupIdFromSchema(d *schema.ResourceData) string {
+	v := d.Get("component").([]interface{})
+	if len(v) != 1 {
+		return ""
+	}
+	component := v[0].(map[string]interface{})
+	parentGroupId, _ := component["parent_group_id"].(string)
+	return parentGroupId
+}